@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"github.com/G-Research/otel-partial-collector/internal/postgres/migrations"
+)
+
+var (
+	tracesProtoUnmarshaler ptrace.ProtoUnmarshaler
+	tracesJSONMarshaler    ptrace.JSONMarshaler
+)
+
+type flagSet struct {
+	*flag.FlagSet
+	postgres string
+	shards   shardFlags
+	clock    partial.Clock
+}
+
+func newFlagSet(name string) *flagSet {
+	fs := &flagSet{FlagSet: flag.NewFlagSet("partialctl "+name, flag.ContinueOnError), clock: partial.ClockLocal}
+	fs.StringVar(&fs.postgres, "postgres", os.Getenv(postgresEnv), "postgres connection string")
+	fs.Var(&fs.shards, "shard", "shard of the ring as name=postgres-url, repeated for every shard, in place of --postgres")
+	fs.Func("clock", "clock the partial spans expire with, local or database as configured in the collector (default local)", func(value string) error {
+		clock := partial.Clock(value)
+		if err := clock.Validate(); err != nil {
+			return err
+		}
+		fs.clock = clock
+		return nil
+	})
+	return fs
+}
+
+// now returns the time the partial spans are compared with, which is the time of the
+// database with the database clock.
+func (fs *flagSet) now(ctx context.Context, db *postgres.ShardedDB) (time.Time, error) {
+	if fs.clock == partial.ClockDatabase {
+		return db.Now(ctx)
+	}
+	return time.Now(), nil
+}
+
+// expired filters the partial spans expired at now. With the database clock, each shard
+// compares the expiration times with its own time.
+func (fs *flagSet) expired(f *postgres.TraceFilter, now time.Time) {
+	if fs.clock == partial.ClockDatabase {
+		f.Expired = true
+		return
+	}
+	f.ExpiredBefore = now
+}
+
+// timestamp returns the time the partial spans are expired at, which is the zero time with
+// the database clock, so each shard expires them at its own time.
+func (fs *flagSet) timestamp() time.Time {
+	if fs.clock == partial.ClockDatabase {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// resolveShards returns the shards of the database, which is a single shard unless the
+// shards are set. The shards take precedence over the connection string of the environment.
+func (fs *flagSet) resolveShards() ([]postgres.ShardConfig, error) {
+	conn := postgres.Config{URL: fs.postgres}
+	if len(fs.shards) > 0 && !fs.isSet("postgres") {
+		conn = postgres.Config{}
+	}
+	if conn.URL == "" && len(fs.shards) == 0 {
+		return nil, fmt.Errorf("missing postgres connection string: set --postgres, --shard or $%s", postgresEnv)
+	}
+	return postgres.ResolveShards(conn, fs.shards)
+}
+
+func (fs *flagSet) isSet(name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+func (fs *flagSet) connect(ctx context.Context) (*postgres.ShardedDB, error) {
+	shards, err := fs.resolveShards()
+	if err != nil {
+		return nil, err
+	}
+	return postgres.NewShardedDB(ctx, shards)
+}
+
+// filterFlags are the flags selecting partial spans shared by the commands.
+type filterFlags struct {
+	tenant       string
+	serviceName  string
+	spanName     string
+	deadLettered bool
+}
+
+func (f *filterFlags) register(fs *flagSet) {
+	fs.StringVar(&f.tenant, "tenant", "", "only partial spans of the tenant")
+	fs.StringVar(&f.serviceName, "service", "", "only partial spans of the service")
+	fs.StringVar(&f.spanName, "span", "", "only partial spans with the span name")
+	fs.BoolVar(&f.deadLettered, "dead-lettered", false, "only partial spans the receiver failed to emit")
+}
+
+func (f *filterFlags) filter() postgres.TraceFilter {
+	return postgres.TraceFilter{
+		Tenant:       f.tenant,
+		ServiceName:  f.serviceName,
+		SpanName:     f.spanName,
+		DeadLettered: f.deadLettered,
+	}
+}
+
+func runList(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := newFlagSet("list")
+	var filter filterFlags
+	filter.register(fs)
+	expired := fs.Bool("expired", false, "only partial spans waiting for the gc")
+	limit := fs.Int("limit", 100, "maximum number of partial spans, 0 for no limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := fs.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	now, err := fs.now(ctx, db)
+	if err != nil {
+		return err
+	}
+	f := filter.filter()
+	f.Limit = *limit
+	if *expired {
+		fs.expired(&f, now)
+	}
+
+	traces, err := db.ListTraces(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	return printTraces(stdout, traces, now)
+}
+
+func printTraces(w io.Writer, traces []*postgres.PartialTrace, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TENANT\tTRACE ID\tSPAN ID\tSERVICE\tSPAN\tSTATE\tAGE\tLAST HEARTBEAT\tEXPIRES AT")
+	for _, pt := range traces {
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			pt.Tenant,
+			pt.TraceID,
+			pt.SpanID,
+			pt.ServiceName,
+			pt.SpanName,
+			traceState(pt, now),
+			now.Sub(pt.StartTime).Round(time.Second),
+			pt.Timestamp.UTC().Format(time.RFC3339),
+			pt.ExpiresAt.UTC().Format(time.RFC3339),
+		)
+	}
+	return tw.Flush()
+}
+
+func traceState(pt *postgres.PartialTrace, now time.Time) string {
+	switch {
+	case pt.DeadLetterReason != "":
+		return "dead-lettered"
+	case pt.Evicted:
+		return "evicted"
+	case pt.Forced:
+		return "forced"
+	case pt.ExpiresAt.Before(now):
+		return "expired"
+	default:
+		return "live"
+	}
+}
+
+func runCount(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := newFlagSet("count")
+	var filter filterFlags
+	filter.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := fs.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	f := filter.filter()
+	total, err := db.CountTraces(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	// the dead-lettered traces are only counted as such, so the columns add up to the total
+	expiredFilter := f
+	fs.expired(&expiredFilter, time.Now())
+	expiredFilter.NotDeadLettered = true
+	expired, err := db.CountTraces(ctx, expiredFilter)
+	if err != nil {
+		return err
+	}
+
+	deadLetteredFilter := f
+	deadLetteredFilter.DeadLettered = true
+	deadLettered, err := db.CountTraces(ctx, deadLetteredFilter)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "LIVE\tEXPIRED\tDEAD LETTERED")
+	fmt.Fprintf(tw, "%d\t%d\t%d\n", total-expired-deadLettered, expired, deadLettered)
+	return tw.Flush()
+}
+
+func runShow(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := newFlagSet("show")
+	tenant := fs.String("tenant", "", "tenant owning the partial span")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: partialctl show [flags] <trace_id> <span_id>\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected a trace id and a span id")
+	}
+
+	db, err := fs.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	pt, err := db.GetTrace(ctx, *tenant, fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	return printTraceJSON(stdout, pt.Trace)
+}
+
+// printTraceJSON decodes the trace stored by the exporter and prints it as OTLP JSON.
+func printTraceJSON(w io.Writer, trace []byte) error {
+	traces, err := tracesProtoUnmarshaler.UnmarshalTraces(trace)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal trace: %w", err)
+	}
+
+	b, err := tracesJSONMarshaler.MarshalTraces(traces)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trace: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, b, "", "  "); err != nil {
+		return fmt.Errorf("failed to indent trace: %w", err)
+	}
+	out.WriteByte('\n')
+
+	_, err = out.WriteTo(w)
+	return err
+}
+
+func runPurge(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := newFlagSet("purge")
+	var filter filterFlags
+	filter.register(fs)
+	olderThan := fs.Duration("older-than", 0, "only partial spans started longer ago than the duration")
+	dryRun := fs.Bool("dry-run", false, "count the partial spans instead of removing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	f := filter.filter()
+	if *olderThan <= 0 && f == (postgres.TraceFilter{}) {
+		return errors.New("refusing to purge every partial span: set --tenant, --service, --span, --dead-lettered or --older-than")
+	}
+
+	db, err := fs.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *olderThan > 0 {
+		now, err := fs.now(ctx, db)
+		if err != nil {
+			return err
+		}
+		f.StartedBefore = now.Add(-*olderThan)
+	}
+
+	if *dryRun {
+		count, err := db.CountTraces(ctx, f)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "would purge %d partial spans\n", count)
+		return nil
+	}
+
+	removed, err := db.RemoveTraces(ctx, f)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "purged %d partial spans\n", removed)
+	return nil
+}
+
+func runRequeue(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := newFlagSet("requeue")
+	var filter filterFlags
+	filter.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := fs.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	requeued, err := db.RequeueDeadLetteredTraces(ctx, filter.filter(), fs.timestamp())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "requeued %d partial spans\n", requeued)
+	return nil
+}
+
+func runMigrate(_ context.Context, args []string, stdout io.Writer) error {
+	fs := newFlagSet("migrate")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	shards, err := fs.resolveShards()
+	if err != nil {
+		return err
+	}
+
+	for _, shard := range shards {
+		if err := migrations.Up(shard.Postgres.URL); err != nil {
+			return fmt.Errorf("shard %q: %w", shard.Name, err)
+		}
+	}
+	fmt.Fprintln(stdout, "schema is up to date")
+	return nil
+}
+
+// shardFlags are the repeated --shard name=url flags describing the shards of the ring.
+type shardFlags []postgres.ShardConfig
+
+func (f *shardFlags) String() string {
+	names := make([]string, 0, len(*f))
+	for _, shard := range *f {
+		names = append(names, shard.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *shardFlags) Set(value string) error {
+	name, conn, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("invalid shard %q: expected name=postgres-url", value)
+	}
+	cfg := postgres.Config{URL: conn}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid shard %q: %w", name, err)
+	}
+	*f = append(*f, postgres.ShardConfig{Name: name, Postgres: cfg})
+	return nil
+}
+
+func runRebalance(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("partialctl rebalance", flag.ContinueOnError)
+	var shards shardFlags
+	fs.Var(&shards, "shard", "shard of the ring as name=postgres-url, repeated for every shard")
+	batchSize := fs.Int("batch-size", 1000, "number of partial spans read at once from a shard")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(shards) == 0 {
+		return errors.New("missing shards: set --shard name=postgres-url for every shard")
+	}
+	if *batchSize <= 0 {
+		return errors.New("batch size must be positive")
+	}
+
+	resolved, err := postgres.ResolveShards(postgres.Config{}, shards)
+	if err != nil {
+		return err
+	}
+
+	db, err := postgres.NewShardedDB(ctx, resolved)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	moved, movedTombstones, err := db.Rebalance(ctx, *batchSize)
+	if err != nil {
+		return fmt.Errorf("rebalance interrupted after moving %d partial spans and %d tombstones: %w", moved, movedTombstones, err)
+	}
+	fmt.Fprintf(stdout, "moved %d partial spans and %d tombstones\n", moved, movedTombstones)
+	return nil
+}
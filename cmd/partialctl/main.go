@@ -0,0 +1,68 @@
+// Command partialctl inspects and manages the partial trace store.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const postgresEnv = "PARTIALCTL_POSTGRES"
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{name: "list", usage: "list partial spans", run: runList},
+	{name: "count", usage: "count live, expired and dead-lettered partial spans", run: runCount},
+	{name: "show", usage: "print a partial span as OTLP JSON", run: runShow},
+	{name: "purge", usage: "remove partial spans without emitting them", run: runPurge},
+	{name: "requeue", usage: "make dead-lettered partial spans subject to the gc again", run: runRequeue},
+	{name: "migrate", usage: "apply the pending schema migrations", run: runMigrate},
+	{name: "rebalance", usage: "move partial spans and tombstones to the shard owning them", run: runRebalance},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "partialctl: %v\n", err)
+		}
+		os.Exit(2)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		usage(stderr)
+		return flag.ErrHelp
+	}
+
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(ctx, args[1:], stdout)
+		}
+	}
+
+	usage(stderr)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: partialctl <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(w, "\nThe postgres connection string is read from --postgres or $%s.\n", postgresEnv)
+	fmt.Fprintf(w, "Sharded stores are set with a --shard name=postgres-url flag per shard.\n")
+}
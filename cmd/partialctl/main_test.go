@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+)
+
+func TestRun(t *testing.T) {
+	t.Setenv(postgresEnv, "")
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "unknown command",
+			args:    []string{"unknown"},
+			wantErr: `unknown command "unknown"`,
+		},
+		{
+			name:    "missing postgres",
+			args:    []string{"list"},
+			wantErr: "missing postgres connection string",
+		},
+		{
+			name:    "purge without filter",
+			args:    []string{"purge", "--postgres", "postgres://localhost/db"},
+			wantErr: "refusing to purge every partial span",
+		},
+		{
+			name:    "rebalance without shards",
+			args:    []string{"rebalance"},
+			wantErr: "missing shards",
+		},
+		{
+			name:    "rebalance with duplicate shards",
+			args:    []string{"rebalance", "--shard", "a=postgres://localhost/a", "--shard", "a=postgres://localhost/b"},
+			wantErr: `duplicate shard name "a"`,
+		},
+		{
+			name:    "rebalance with invalid shard",
+			args:    []string{"rebalance", "--shard", "postgres://localhost/a"},
+			wantErr: "expected name=postgres-url",
+		},
+		{
+			name:    "postgres and shards",
+			args:    []string{"list", "--postgres", "postgres://localhost/db", "--shard", "a=postgres://localhost/a"},
+			wantErr: "postgres and shards cannot be both configured",
+		},
+		{
+			name:    "duplicate shards",
+			args:    []string{"count", "--shard", "a=postgres://localhost/a", "--shard", "a=postgres://localhost/b"},
+			wantErr: `duplicate shard name "a"`,
+		},
+		{
+			name:    "invalid clock",
+			args:    []string{"list", "--postgres", "postgres://localhost/db", "--clock", "ntp"},
+			wantErr: `invalid clock: "ntp"`,
+		},
+		{
+			name:    "show without ids",
+			args:    []string{"show", "--postgres", "postgres://localhost/db"},
+			wantErr: "expected a trace id and a span id",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := run(context.Background(), tt.args, &stdout, &stderr)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestPrintTraces(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	traces := []*postgres.PartialTrace{
+		{
+			Tenant:      "team-a",
+			TraceID:     "0102030405060708090a0b0c0d0e0f10",
+			SpanID:      "0102030405060708",
+			ServiceName: "checkout",
+			SpanName:    "process",
+			StartTime:   now.Add(-time.Hour),
+			Timestamp:   now.Add(-time.Minute),
+			ExpiresAt:   now.Add(time.Minute),
+		},
+		{
+			TraceID:          "0102030405060708090a0b0c0d0e0f10",
+			SpanID:           "0807060504030201",
+			ServiceName:      "billing",
+			SpanName:         "charge",
+			StartTime:        now.Add(-time.Hour),
+			Timestamp:        now.Add(-time.Minute),
+			ExpiresAt:        now.Add(-time.Second),
+			DeadLetterReason: "invalid trace",
+		},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, printTraces(&out, traces, now))
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 3)
+	assert.Contains(t, string(lines[1]), "team-a")
+	assert.Contains(t, string(lines[1]), "checkout")
+	assert.Contains(t, string(lines[1]), "live")
+	assert.Contains(t, string(lines[1]), "1h0m0s")
+	assert.Contains(t, string(lines[2]), "dead-lettered")
+}
+
+func TestTraceState(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, "live", traceState(&postgres.PartialTrace{ExpiresAt: now.Add(time.Second)}, now))
+	assert.Equal(t, "expired", traceState(&postgres.PartialTrace{ExpiresAt: now.Add(-time.Second)}, now))
+	assert.Equal(t, "evicted", traceState(&postgres.PartialTrace{ExpiresAt: now, Forced: true, Evicted: true}, now))
+	assert.Equal(t, "forced", traceState(&postgres.PartialTrace{ExpiresAt: now, Forced: true}, now))
+	assert.Equal(t, "dead-lettered", traceState(&postgres.PartialTrace{ExpiresAt: now, DeadLetterReason: "x"}, now))
+}
+
+func TestPrintTraceJSON(t *testing.T) {
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("process")
+
+	var marshaler ptrace.ProtoMarshaler
+	b, err := marshaler.MarshalTraces(traces)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, printTraceJSON(&out, b))
+	assert.Contains(t, out.String(), `"name": "process"`)
+
+	assert.Error(t, printTraceJSON(&out, []byte("invalid")))
+}
+
+func TestShardFlags(t *testing.T) {
+	var shards shardFlags
+	require.NoError(t, shards.Set("a=postgres://localhost/a?sslmode=disable"))
+	require.NoError(t, shards.Set("b=postgres://localhost/b"))
+	assert.Equal(t, shardFlags{
+		{Name: "a", Postgres: postgres.Config{URL: "postgres://localhost/a?sslmode=disable"}},
+		{Name: "b", Postgres: postgres.Config{URL: "postgres://localhost/b"}},
+	}, shards)
+	assert.Equal(t, "a,b", shards.String())
+
+	assert.ErrorContains(t, shards.Set("c=postgres://:invalid"), "invalid postgres config")
+}
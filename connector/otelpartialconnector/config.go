@@ -0,0 +1,51 @@
+package otelpartialconnector
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+)
+
+// Config defines configuration for otelpartialconnector.
+type Config struct {
+	// ExpiryFactor multiplies the heartbeat interval with the ExpiryFactor
+	// to get the expiration time for the trace.
+	ExpiryFactor int `mapstructure:"expiry_factor"`
+	// GCInterval is the interval at which expired traces are collected.
+	GCInterval string `mapstructure:"gc_interval"`
+	// Completion configures how garbage collected spans are completed
+	// before they are sent through the pipeline.
+	Completion partial.CompletionConfig `mapstructure:"completion"`
+	// MaxSpans is the maximum number of partial spans kept in memory. The oldest spans over
+	// the limit are evicted and sent by the next gc with the evicted reason. Zero disables the limit.
+	MaxSpans int `mapstructure:"max_spans"`
+}
+
+func createDefaultConfig() component.Config {
+	return &Config{
+		ExpiryFactor: 3,
+		GCInterval:   "5s",
+		Completion:   partial.DefaultCompletionConfig(),
+		MaxSpans:     100000,
+	}
+}
+
+func (c *Config) Validate() error {
+	if c.ExpiryFactor <= 0 {
+		return errors.New("expiry factor cannot be less than or equal to 0")
+	}
+
+	if _, err := time.ParseDuration(c.GCInterval); err != nil {
+		return fmt.Errorf("failed to parse interval duration: %w", err)
+	}
+
+	if c.MaxSpans < 0 {
+		return errors.New("max spans cannot be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package otelpartialconnector
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/confmap/confmaptest"
+	"go.opentelemetry.io/collector/confmap/xconfmap"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+	cm, err := confmaptest.LoadConf(filepath.Join("testdata", "config.yaml"))
+	require.NoError(t, err)
+
+	want := &Config{
+		ExpiryFactor: 2,
+		GCInterval:   "10s",
+		MaxSpans:     1000,
+		Completion: partial.CompletionConfig{
+			EndTime:       partial.EndTimeLastHeartbeat,
+			ErrorStatus:   true,
+			StatusMessage: "abandoned",
+		},
+	}
+
+	got := createDefaultConfig().(*Config)
+	sub, err := cm.Sub(typeStr.String())
+	require.NoError(t, err)
+	require.NoError(t, sub.Unmarshal(got))
+
+	assert.NoError(t, xconfmap.Validate(got))
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,198 @@
+package otelpartialconnector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/connector"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/protocol"
+	"go.uber.org/zap"
+)
+
+var typeStr = component.MustNewType("otelpartialconnector")
+
+var (
+	tracesProtoMarshaler   ptrace.ProtoMarshaler
+	tracesProtoUnmarshaler ptrace.ProtoUnmarshaler
+)
+
+// otelPartialConnector combines the otelpartialexporter and otelpartialreceiver in a single
+// component. It receives heartbeat logs, keeps partial traces in memory and sends expired
+// traces through the traces pipeline.
+type otelPartialConnector struct {
+	consumer     consumer.Traces
+	store        *memoryStore
+	expiryFactor int
+	gcInterval   time.Duration
+	completion   partial.CompletionConfig
+
+	logger *zap.Logger
+
+	cancelFunc context.CancelFunc
+	doneCh     chan struct{}
+}
+
+func newPartialConnector(_ context.Context, settings connector.Settings, baseCfg component.Config, consumer consumer.Traces) (connector.Logs, error) {
+	cfg := baseCfg.(*Config)
+	d, err := time.ParseDuration(cfg.GCInterval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse duration interval: %w", err)
+	}
+
+	return &otelPartialConnector{
+		consumer:     consumer,
+		store:        newMemoryStore(cfg.MaxSpans),
+		expiryFactor: cfg.ExpiryFactor,
+		gcInterval:   d,
+		completion:   cfg.Completion,
+		logger:       settings.Logger,
+	}, nil
+}
+
+func (c *otelPartialConnector) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: true}
+}
+
+func (c *otelPartialConnector) Start(context.Context, component.Host) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancelFunc = cancel
+	c.doneCh = make(chan struct{})
+
+	c.logger.Info("Starting gc loop", zap.String("gc_interval", c.gcInterval.String()))
+	go c.loop(ctx)
+
+	return nil
+}
+
+func (c *otelPartialConnector) Shutdown(context.Context) error {
+	c.logger.Info("Shutting down otel partial connector")
+	if c.cancelFunc != nil {
+		c.cancelFunc()
+		<-c.doneCh
+	}
+
+	if n := c.store.len(); n > 0 {
+		c.logger.Warn("Partial traces kept in memory are lost on shutdown", zap.Int("count", n))
+	}
+	return nil
+}
+
+func (c *otelPartialConnector) ConsumeLogs(_ context.Context, logs plog.Logs) error {
+	now := time.Now().UTC()
+	resourceLogs := logs.ResourceLogs()
+	for i := range resourceLogs.Len() {
+		resourceLog := resourceLogs.At(i)
+		resourceAttrs := resourceLog.Resource().Attributes()
+		scopeLogs := resourceLog.ScopeLogs()
+		for j := range scopeLogs.Len() {
+			records := scopeLogs.At(j).LogRecords()
+			for k := range records.Len() {
+				msg, err := protocol.Decode(records.At(k))
+				if errors.Is(err, protocol.ErrInvalidBody) {
+					return fmt.Errorf("failed to unmarshal traces: %w", err)
+				}
+				if err != nil {
+					c.logger.Warn("Failed to decode log record", zap.Error(err))
+					continue
+				}
+
+				switch msg.Event {
+				case protocol.EventTypeHeartbeat:
+					for _, t := range partial.FlattenTraces(msg.Traces) {
+						partial.MergeAttributes(t.ResourceSpans().At(0).Resource().Attributes(), resourceAttrs)
+						span := t.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+
+						b, err := tracesProtoMarshaler.MarshalTraces(t)
+						if err != nil {
+							return fmt.Errorf("failed to marshal trace %v: %w", t, err)
+						}
+
+						if evicted := c.store.putTrace(&partialTrace{
+							key:               spanKey{traceID: span.TraceID(), spanID: span.SpanID()},
+							trace:             b,
+							timestamp:         now,
+							expiresAt:         now.Add(msg.HeartbeatInterval * time.Duration(c.expiryFactor)),
+							heartbeatInterval: msg.HeartbeatInterval,
+						}, now); evicted > 0 {
+							c.logger.Debug("Evicted the oldest partial span over the max spans", zap.Int("max_spans", c.store.maxSpans))
+						}
+					}
+				case protocol.EventTypeStop:
+					for _, t := range partial.FlattenTraces(msg.Traces) {
+						span := t.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+						c.store.removeTrace(spanKey{traceID: span.TraceID(), spanID: span.SpanID()})
+					}
+
+				default:
+					// assertion
+					panic("unreachable")
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *otelPartialConnector) loop(ctx context.Context) {
+	ticker := time.NewTicker(c.gcInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.logger.Info("Stopping gc loop after shutdown")
+			close(c.doneCh)
+			return
+		case <-ticker.C:
+			if err := c.gc(ctx, time.Now().UTC()); err != nil {
+				c.logger.Error("encountered errors while running gc", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (c *otelPartialConnector) gc(ctx context.Context, now time.Time) error {
+	var errs []error
+	for _, pt := range c.store.listExpiredTraces(now) {
+		trace, err := tracesProtoUnmarshaler.UnmarshalTraces(pt.trace)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to unmarshal traces: %w", err))
+			continue
+		}
+
+		reason := partial.GCReasonExpired
+		if pt.evicted {
+			reason = partial.GCReasonEvicted
+		}
+		span := trace.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+		c.completion.Complete(span, pt.timestamp, pt.heartbeatInterval, reason, now)
+
+		if err := c.consumer.ConsumeTraces(ctx, trace); err != nil {
+			errs = append(errs, fmt.Errorf("failed to consume trace %v: %w", trace, err))
+			continue
+		}
+
+		c.store.removeIfUnchanged(pt)
+	}
+
+	return errors.Join(errs...)
+}
+
+func NewFactory() connector.Factory {
+	return connector.NewFactory(
+		typeStr,
+		createDefaultConfig,
+		connector.WithLogsToTraces(
+			newPartialConnector,
+			component.StabilityLevelAlpha,
+		),
+	)
+}
@@ -0,0 +1,132 @@
+package otelpartialconnector
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/connector/connectortest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func newHeartbeatLogs(t *testing.T, event string, span ptrace.Span) plog.Logs {
+	traces := ptrace.NewTraces()
+	span.CopyTo(traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty())
+	b, err := tracesProtoMarshaler.MarshalTraces(traces)
+	require.NoError(t, err)
+
+	logs := plog.NewLogs()
+	resourceLog := logs.ResourceLogs().AppendEmpty()
+	resourceLog.Resource().Attributes().PutStr("service.name", "checkout")
+	record := resourceLog.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	record.Body().SetStr(base64.StdEncoding.EncodeToString(b))
+	record.Attributes().PutStr("partial.event", event)
+	record.Attributes().PutStr("partial.frequency", "1s")
+	return logs
+}
+
+func TestConnector(t *testing.T) {
+	sink := new(consumertest.TracesSink)
+	cfg := createDefaultConfig().(*Config)
+	c, err := newPartialConnector(context.Background(), connectortest.NewNopSettings(typeStr), cfg, sink)
+	require.NoError(t, err)
+	pc := c.(*otelPartialConnector)
+
+	abandoned := ptrace.NewSpan()
+	abandoned.SetName("abandoned")
+	abandoned.SetTraceID(pcommon.TraceID{1})
+	abandoned.SetSpanID(pcommon.SpanID{1})
+
+	stopped := ptrace.NewSpan()
+	stopped.SetName("stopped")
+	stopped.SetTraceID(pcommon.TraceID{2})
+	stopped.SetSpanID(pcommon.SpanID{2})
+
+	ctx := context.Background()
+	require.NoError(t, pc.ConsumeLogs(ctx, newHeartbeatLogs(t, "heartbeat", abandoned)))
+	require.NoError(t, pc.ConsumeLogs(ctx, newHeartbeatLogs(t, "heartbeat", stopped)))
+	require.NoError(t, pc.ConsumeLogs(ctx, newHeartbeatLogs(t, "stop", stopped)))
+	assert.Equal(t, 1, pc.store.len())
+
+	// nothing expired yet
+	require.NoError(t, pc.gc(ctx, time.Now().UTC()))
+	assert.Empty(t, sink.AllTraces())
+
+	require.NoError(t, pc.gc(ctx, time.Now().UTC().Add(time.Minute)))
+	require.Len(t, sink.AllTraces(), 1)
+	assert.Equal(t, 0, pc.store.len())
+
+	rs := sink.AllTraces()[0].ResourceSpans().At(0)
+	serviceName, ok := rs.Resource().Attributes().Get("service.name")
+	require.True(t, ok)
+	assert.Equal(t, "checkout", serviceName.Str())
+
+	span := rs.ScopeSpans().At(0).Spans().At(0)
+	assert.Equal(t, "abandoned", span.Name())
+	reason, ok := span.Attributes().Get("partial.gc.reason")
+	require.True(t, ok)
+	assert.Equal(t, "expired", reason.Str())
+}
+
+func TestConnectorKeepsTraceOnConsumeError(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	c, err := newPartialConnector(context.Background(), connectortest.NewNopSettings(typeStr), cfg, consumertest.NewErr(assert.AnError))
+	require.NoError(t, err)
+	pc := c.(*otelPartialConnector)
+
+	span := ptrace.NewSpan()
+	span.SetTraceID(pcommon.TraceID{1})
+	span.SetSpanID(pcommon.SpanID{1})
+
+	ctx := context.Background()
+	require.NoError(t, pc.ConsumeLogs(ctx, newHeartbeatLogs(t, "heartbeat", span)))
+	require.Error(t, pc.gc(ctx, time.Now().UTC().Add(time.Minute)))
+	assert.Equal(t, 1, pc.store.len())
+}
+
+func TestConnectorMaxSpans(t *testing.T) {
+	sink := new(consumertest.TracesSink)
+	cfg := createDefaultConfig().(*Config)
+	cfg.MaxSpans = 2
+	c, err := newPartialConnector(context.Background(), connectortest.NewNopSettings(typeStr), cfg, sink)
+	require.NoError(t, err)
+	pc := c.(*otelPartialConnector)
+
+	spans := make([]ptrace.Span, 3)
+	for i := range spans {
+		spans[i] = ptrace.NewSpan()
+		spans[i].SetName(fmt.Sprintf("span-%d", i))
+		spans[i].SetTraceID(pcommon.TraceID{byte(i + 1)})
+		spans[i].SetSpanID(pcommon.SpanID{byte(i + 1)})
+	}
+
+	ctx := context.Background()
+	for _, span := range spans[:2] {
+		require.NoError(t, pc.ConsumeLogs(ctx, newHeartbeatLogs(t, "heartbeat", span)))
+	}
+	// the heartbeats of a kept span don't evict anything
+	require.NoError(t, pc.ConsumeLogs(ctx, newHeartbeatLogs(t, "heartbeat", spans[0])))
+	require.NoError(t, pc.gc(ctx, time.Now().UTC()))
+	assert.Empty(t, sink.AllTraces())
+
+	// the third span evicts the oldest one, which stays evicted when it heartbeats again
+	require.NoError(t, pc.ConsumeLogs(ctx, newHeartbeatLogs(t, "heartbeat", spans[2])))
+	require.NoError(t, pc.ConsumeLogs(ctx, newHeartbeatLogs(t, "heartbeat", spans[0])))
+	require.NoError(t, pc.gc(ctx, time.Now().UTC().Add(time.Millisecond)))
+	require.Len(t, sink.AllTraces(), 1)
+	assert.Equal(t, 2, pc.store.len())
+
+	evicted := sink.AllTraces()[0].ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+	assert.Equal(t, "span-0", evicted.Name())
+	reason, ok := evicted.Attributes().Get("partial.gc.reason")
+	require.True(t, ok)
+	assert.Equal(t, "evicted", reason.Str())
+}
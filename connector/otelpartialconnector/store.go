@@ -0,0 +1,126 @@
+package otelpartialconnector
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+type spanKey struct {
+	traceID pcommon.TraceID
+	spanID  pcommon.SpanID
+}
+
+// partialTrace is the in-memory equivalent of a row in the partial_traces table.
+type partialTrace struct {
+	key spanKey
+	// Marshaled trace to byte slice
+	trace             []byte
+	timestamp         time.Time
+	expiresAt         time.Time
+	heartbeatInterval time.Duration
+	// evicted is set when the trace is expired early to stay under the max spans
+	evicted bool
+}
+
+// memoryStore keeps the partial traces in memory, so the connector doesn't need a database.
+type memoryStore struct {
+	mu     sync.Mutex
+	traces map[spanKey]*partialTrace
+	// maxSpans is the maximum number of traces not evicted, 0 when unlimited
+	maxSpans int
+	// order holds the keys of the traces not evicted by first heartbeat, oldest first
+	order    *list.List
+	elements map[spanKey]*list.Element
+}
+
+func newMemoryStore(maxSpans int) *memoryStore {
+	return &memoryStore{
+		traces:   make(map[spanKey]*partialTrace),
+		maxSpans: maxSpans,
+		order:    list.New(),
+		elements: make(map[spanKey]*list.Element),
+	}
+}
+
+// putTrace stores the trace. A new trace over the max spans evicts the oldest trace, which
+// expires at now. It returns the number of evicted traces.
+func (s *memoryStore) putTrace(pt *partialTrace, now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.traces[pt.key]; ok && old.evicted {
+		// the trace stays evicted until the gc sends it
+		pt.evicted = true
+		pt.expiresAt = old.expiresAt
+		s.traces[pt.key] = pt
+		return 0
+	}
+
+	var evicted int
+	if _, ok := s.elements[pt.key]; !ok {
+		if s.maxSpans > 0 && s.order.Len() >= s.maxSpans {
+			s.evictOldest(now)
+			evicted++
+		}
+		s.elements[pt.key] = s.order.PushBack(pt.key)
+	}
+	s.traces[pt.key] = pt
+	return evicted
+}
+
+// evictOldest expires the oldest trace not evicted at now. The trace is replaced
+// rather than changed, as the gc may be reading it.
+func (s *memoryStore) evictOldest(now time.Time) {
+	key := s.order.Remove(s.order.Front()).(spanKey)
+	delete(s.elements, key)
+
+	pt := *s.traces[key]
+	pt.evicted = true
+	pt.expiresAt = now
+	s.traces[key] = &pt
+}
+
+func (s *memoryStore) removeTrace(key spanKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(key)
+}
+
+// removeIfUnchanged removes the trace unless it has been replaced by a newer heartbeat.
+func (s *memoryStore) removeIfUnchanged(pt *partialTrace) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.traces[pt.key] == pt {
+		s.removeLocked(pt.key)
+	}
+}
+
+func (s *memoryStore) removeLocked(key spanKey) {
+	delete(s.traces, key)
+	if e, ok := s.elements[key]; ok {
+		s.order.Remove(e)
+		delete(s.elements, key)
+	}
+}
+
+func (s *memoryStore) listExpiredTraces(timestamp time.Time) []*partialTrace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var traces []*partialTrace
+	for _, pt := range s.traces {
+		if pt.expiresAt.Before(timestamp) {
+			traces = append(traces, pt)
+		}
+	}
+	return traces
+}
+
+func (s *memoryStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.traces)
+}
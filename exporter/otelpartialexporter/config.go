@@ -2,34 +2,80 @@ package otelpartialexporter
 
 import (
 	"errors"
-	"fmt"
-
-	"github.com/jackc/pgx/v5"
 
 	"go.opentelemetry.io/collector/component"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"github.com/G-Research/otel-partial-collector/protocol"
 )
 
 // Config defines configuration for otelpartialexporter.
 type Config struct {
-	// Postgres is URL used to connect to the postgres instance.
-	Postgres string `mapstructure:"postgres"`
+	// Postgres configures the connection to the postgres instance, as a URL or as structured settings.
+	Postgres postgres.Config `mapstructure:"postgres"`
+	// Shards spreads the partial spans between several postgres instances
+	// instead of the single Postgres instance.
+	Shards []postgres.ShardConfig `mapstructure:"shards"`
 	// ExpiryFactor multiplies the heartbeat interval with the ExpiryFactor
 	// to get the expiration time for the trace.
 	ExpiryFactor int `mapstructure:"expiry_factor"`
+	// Tenant configures how the tenant owning a partial span is derived.
+	Tenant TenantConfig `mapstructure:"tenant"`
+	// Quota limits the number of live partial spans.
+	Quota QuotaConfig `mapstructure:"quota"`
+	// Limits limits the size of the stored spans.
+	Limits LimitsConfig `mapstructure:"limits"`
+	// Lifetime limits how long a partial span is kept regardless of its heartbeats.
+	Lifetime LifetimeConfig `mapstructure:"lifetime"`
+	// Protocol selects the accepted versions of the heartbeat protocol.
+	Protocol ProtocolConfig `mapstructure:"protocol"`
+	// Clock selects the clock the expiration times are computed with: "local" or "database".
+	Clock partial.Clock `mapstructure:"clock"`
+	// HeartbeatTime selects the time the heartbeats are stored with.
+	HeartbeatTime HeartbeatTimeConfig `mapstructure:"heartbeat_time"`
+	// DetectResurrections flags the partial spans heartbeating again after the receiver emitted them,
+	// when the receiver records the ids of the emitted spans.
+	DetectResurrections bool `mapstructure:"detect_resurrections"`
 }
 
 func createDefaultConfig() component.Config {
-	return &Config{}
+	return &Config{
+		Quota: QuotaConfig{
+			Policy: QuotaPolicyReject,
+		},
+		Limits: LimitsConfig{
+			MaxSpanSize:   1 << 20,
+			MaxAttributes: 128,
+			MaxEvents:     128,
+		},
+		Lifetime: LifetimeConfig{
+			From: LifetimeFromStartTime,
+		},
+		Protocol: ProtocolConfig{
+			AcceptedVersions: protocol.SupportedVersions,
+		},
+		Clock: partial.ClockLocal,
+		HeartbeatTime: HeartbeatTimeConfig{
+			Source:  HeartbeatTimeReceipt,
+			MaxSkew: "1m",
+		},
+	}
 }
 
 func (c *Config) Validate() error {
-	if _, err := pgx.ParseConfig(c.Postgres); err != nil {
-		return fmt.Errorf("invalid postgres config: %w", err)
+	if _, err := postgres.ResolveShards(c.Postgres, c.Shards); err != nil {
+		return err
 	}
 
 	if c.ExpiryFactor <= 0 {
 		return errors.New("expiry factor cannot be less than or equal to 0")
 	}
 
+	// the skew of the log record times is measured with the clock of the exporter
+	if c.Clock == partial.ClockDatabase && c.HeartbeatTime.fromRecord() {
+		return errors.New("heartbeat time of the log records cannot be used with the database clock")
+	}
+
 	return nil
 }
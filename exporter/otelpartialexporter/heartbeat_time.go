@@ -0,0 +1,112 @@
+package otelpartialexporter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// HeartbeatTimeConfig selects the time a heartbeat is stored with, which is the last
+// heartbeat time of the partial span and the base of its expiration time.
+type HeartbeatTimeConfig struct {
+	// Source selects the time of the heartbeat. Valid values are "receipt", "timestamp"
+	// and "observed_timestamp".
+	Source HeartbeatTimeSource `mapstructure:"source"`
+	// MaxSkew is the maximum difference between the time of the log record and the
+	// time it is received. The receipt time is used beyond it.
+	MaxSkew string `mapstructure:"max_skew"`
+}
+
+type HeartbeatTimeSource string
+
+const (
+	// HeartbeatTimeReceipt uses the time the heartbeat is processed by the exporter.
+	HeartbeatTimeReceipt HeartbeatTimeSource = "receipt"
+	// HeartbeatTimeTimestamp uses the timestamp of the log record, or its observed
+	// timestamp when it is not set.
+	HeartbeatTimeTimestamp HeartbeatTimeSource = "timestamp"
+	// HeartbeatTimeObservedTimestamp uses the observed timestamp of the log record.
+	HeartbeatTimeObservedTimestamp HeartbeatTimeSource = "observed_timestamp"
+)
+
+func (c *HeartbeatTimeConfig) Validate() error {
+	switch c.Source {
+	case HeartbeatTimeReceipt, HeartbeatTimeTimestamp, HeartbeatTimeObservedTimestamp:
+	default:
+		return fmt.Errorf("invalid heartbeat time source: %q", c.Source)
+	}
+
+	maxSkew, err := c.maxSkew()
+	if err != nil {
+		return err
+	}
+
+	if maxSkew <= 0 {
+		return errors.New("max skew must be positive")
+	}
+
+	return nil
+}
+
+func (c *HeartbeatTimeConfig) maxSkew() (time.Duration, error) {
+	d, err := time.ParseDuration(c.MaxSkew)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse max skew: %w", err)
+	}
+	return d, nil
+}
+
+// fromRecord reports whether the heartbeats are stored with the time of their log record.
+func (c *HeartbeatTimeConfig) fromRecord() bool {
+	return c.Source.fromRecord()
+}
+
+func (s HeartbeatTimeSource) fromRecord() bool {
+	return s == HeartbeatTimeTimestamp || s == HeartbeatTimeObservedTimestamp
+}
+
+// heartbeatTime is the HeartbeatTimeConfig of the exporter, with the maximum skew parsed.
+type heartbeatTime struct {
+	source  HeartbeatTimeSource
+	maxSkew time.Duration
+}
+
+func (c *HeartbeatTimeConfig) parse() (heartbeatTime, error) {
+	maxSkew, err := c.maxSkew()
+	if err != nil {
+		return heartbeatTime{}, err
+	}
+	return heartbeatTime{source: c.Source, maxSkew: maxSkew}, nil
+}
+
+// fromRecord reports whether the heartbeats are stored with the time of their log record.
+func (h *heartbeatTime) fromRecord() bool {
+	return h.source.fromRecord()
+}
+
+// time returns the time of the heartbeat received at now, which is now unless the time of
+// the log record is selected, set and within the maximum skew.
+func (h *heartbeatTime) time(logRecord plog.LogRecord, now time.Time) time.Time {
+	var ts pcommon.Timestamp
+	switch h.source {
+	case HeartbeatTimeTimestamp:
+		ts = logRecord.Timestamp()
+		if ts == 0 {
+			ts = logRecord.ObservedTimestamp()
+		}
+	case HeartbeatTimeObservedTimestamp:
+		ts = logRecord.ObservedTimestamp()
+	}
+	if ts == 0 {
+		return now
+	}
+
+	t := ts.AsTime()
+	if skew := now.Sub(t); skew > h.maxSkew || skew < -h.maxSkew {
+		return now
+	}
+	return t
+}
@@ -0,0 +1,103 @@
+package otelpartialexporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+func TestHeartbeatTime(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	timestamp := now.Add(-10 * time.Second)
+	observed := now.Add(-5 * time.Second)
+
+	for _, tt := range []struct {
+		name      string
+		source    HeartbeatTimeSource
+		timestamp time.Time
+		observed  time.Time
+		want      time.Time
+	}{
+		{
+			name:      "receipt",
+			source:    HeartbeatTimeReceipt,
+			timestamp: timestamp,
+			observed:  observed,
+			want:      now,
+		},
+		{
+			name:      "timestamp",
+			source:    HeartbeatTimeTimestamp,
+			timestamp: timestamp,
+			observed:  observed,
+			want:      timestamp,
+		},
+		{
+			name:     "timestamp missing",
+			source:   HeartbeatTimeTimestamp,
+			observed: observed,
+			want:     observed,
+		},
+		{
+			name:      "observed timestamp",
+			source:    HeartbeatTimeObservedTimestamp,
+			timestamp: timestamp,
+			observed:  observed,
+			want:      observed,
+		},
+		{
+			name:      "observed timestamp missing",
+			source:    HeartbeatTimeObservedTimestamp,
+			timestamp: timestamp,
+			want:      now,
+		},
+		{
+			name:      "past skew",
+			source:    HeartbeatTimeTimestamp,
+			timestamp: now.Add(-2 * time.Minute),
+			want:      now,
+		},
+		{
+			name:      "future skew",
+			source:    HeartbeatTimeTimestamp,
+			timestamp: now.Add(2 * time.Minute),
+			want:      now,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			logRecord := plog.NewLogRecord()
+			if !tt.timestamp.IsZero() {
+				logRecord.SetTimestamp(pcommon.NewTimestampFromTime(tt.timestamp))
+			}
+			if !tt.observed.IsZero() {
+				logRecord.SetObservedTimestamp(pcommon.NewTimestampFromTime(tt.observed))
+			}
+
+			h := heartbeatTime{source: tt.source, maxSkew: time.Minute}
+			assert.Equal(t, tt.want, h.time(logRecord, now).UTC())
+		})
+	}
+}
+
+func TestHeartbeatTimeValidate(t *testing.T) {
+	assert.NoError(t, (&HeartbeatTimeConfig{Source: HeartbeatTimeReceipt, MaxSkew: "1m"}).Validate())
+	assert.NoError(t, (&HeartbeatTimeConfig{Source: HeartbeatTimeObservedTimestamp, MaxSkew: "30s"}).Validate())
+	assert.Error(t, (&HeartbeatTimeConfig{Source: "sent", MaxSkew: "1m"}).Validate())
+	assert.Error(t, (&HeartbeatTimeConfig{Source: HeartbeatTimeTimestamp, MaxSkew: "0s"}).Validate())
+	assert.Error(t, (&HeartbeatTimeConfig{Source: HeartbeatTimeTimestamp, MaxSkew: "soon"}).Validate())
+}
+
+func TestHeartbeatTimeParse(t *testing.T) {
+	h, err := (&HeartbeatTimeConfig{Source: HeartbeatTimeObservedTimestamp, MaxSkew: "30s"}).parse()
+	require.NoError(t, err)
+	assert.Equal(t, heartbeatTime{source: HeartbeatTimeObservedTimestamp, maxSkew: 30 * time.Second}, h)
+	assert.True(t, h.fromRecord())
+
+	_, err = (&HeartbeatTimeConfig{Source: HeartbeatTimeReceipt, MaxSkew: "soon"}).parse()
+	assert.Error(t, err)
+}
@@ -0,0 +1,92 @@
+package otelpartialexporter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// LifetimeConfig limits how long a partial span is kept regardless of its heartbeats,
+// so spans heartbeating forever are still emitted by the receiver.
+type LifetimeConfig struct {
+	// Max is the maximum lifetime of a partial span. Empty disables the limit.
+	Max string `mapstructure:"max"`
+	// From selects the time the lifetime is measured from. Valid values are
+	// "start_time" and "first_heartbeat".
+	From LifetimeBase `mapstructure:"from"`
+}
+
+type LifetimeBase string
+
+const (
+	LifetimeFromStartTime      LifetimeBase = "start_time"
+	LifetimeFromFirstHeartbeat LifetimeBase = "first_heartbeat"
+)
+
+func (c *LifetimeConfig) Validate() error {
+	switch c.From {
+	case LifetimeFromStartTime, LifetimeFromFirstHeartbeat:
+	default:
+		return fmt.Errorf("invalid lifetime base: %q", c.From)
+	}
+
+	maxLifetime, err := c.maxLifetime()
+	if err != nil {
+		return err
+	}
+
+	if c.Max != "" && maxLifetime <= 0 {
+		return errors.New("max lifetime must be positive")
+	}
+
+	return nil
+}
+
+// maxLifetime parses the maximum lifetime, which is 0 when it is not limited.
+func (c *LifetimeConfig) maxLifetime() (time.Duration, error) {
+	if c.Max == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(c.Max)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse max lifetime: %w", err)
+	}
+	return d, nil
+}
+
+// lifetimeLimit is the LifetimeConfig of the exporter, with the maximum lifetime parsed.
+type lifetimeLimit struct {
+	// max is the maximum lifetime, or 0 when it is not limited
+	max  time.Duration
+	from LifetimeBase
+}
+
+func (c *LifetimeConfig) limit() (lifetimeLimit, error) {
+	maxLifetime, err := c.maxLifetime()
+	if err != nil {
+		return lifetimeLimit{}, err
+	}
+	return lifetimeLimit{max: maxLifetime, from: c.From}, nil
+}
+
+// expiresAt returns the time a partial span first heartbeating at now expires regardless of its
+// heartbeats, or the zero time when the lifetime is not limited. Spans without a start time are
+// measured from the first heartbeat.
+func (l *lifetimeLimit) expiresAt(startTime pcommon.Timestamp, now time.Time) time.Time {
+	if l.max == 0 {
+		return time.Time{}
+	}
+
+	if !l.fromFirstHeartbeat(startTime) {
+		return startTime.AsTime().Add(l.max)
+	}
+	return now.Add(l.max)
+}
+
+// fromFirstHeartbeat reports whether the lifetime of a partial span is measured from its first heartbeat.
+func (l *lifetimeLimit) fromFirstHeartbeat(startTime pcommon.Timestamp) bool {
+	return l.from == LifetimeFromFirstHeartbeat || startTime == 0
+}
@@ -0,0 +1,70 @@
+package otelpartialexporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+func TestLifetimeExpiresAt(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	startTime := pcommon.NewTimestampFromTime(now.Add(-time.Hour))
+
+	for _, tt := range []struct {
+		name      string
+		limit     lifetimeLimit
+		startTime pcommon.Timestamp
+		want      time.Time
+	}{
+		{
+			name:      "disabled",
+			limit:     lifetimeLimit{from: LifetimeFromStartTime},
+			startTime: startTime,
+			want:      time.Time{},
+		},
+		{
+			name:      "start time",
+			limit:     lifetimeLimit{max: 24 * time.Hour, from: LifetimeFromStartTime},
+			startTime: startTime,
+			want:      now.Add(23 * time.Hour),
+		},
+		{
+			name:      "start time missing",
+			limit:     lifetimeLimit{max: 24 * time.Hour, from: LifetimeFromStartTime},
+			startTime: 0,
+			want:      now.Add(24 * time.Hour),
+		},
+		{
+			name:      "first heartbeat",
+			limit:     lifetimeLimit{max: 24 * time.Hour, from: LifetimeFromFirstHeartbeat},
+			startTime: startTime,
+			want:      now.Add(24 * time.Hour),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.limit.expiresAt(tt.startTime, now).UTC())
+		})
+	}
+}
+
+func TestLifetimeValidate(t *testing.T) {
+	assert.NoError(t, (&LifetimeConfig{From: LifetimeFromStartTime}).Validate())
+	assert.NoError(t, (&LifetimeConfig{Max: "1h", From: LifetimeFromFirstHeartbeat}).Validate())
+	assert.Error(t, (&LifetimeConfig{Max: "1h", From: "end_time"}).Validate())
+	assert.Error(t, (&LifetimeConfig{Max: "-1h", From: LifetimeFromStartTime}).Validate())
+	assert.Error(t, (&LifetimeConfig{Max: "forever", From: LifetimeFromStartTime}).Validate())
+}
+
+func TestLifetimeLimit(t *testing.T) {
+	limit, err := (&LifetimeConfig{Max: "1h", From: LifetimeFromFirstHeartbeat}).limit()
+	require.NoError(t, err)
+	assert.Equal(t, lifetimeLimit{max: time.Hour, from: LifetimeFromFirstHeartbeat}, limit)
+
+	limit, err = (&LifetimeConfig{From: LifetimeFromStartTime}).limit()
+	require.NoError(t, err)
+	assert.Equal(t, lifetimeLimit{from: LifetimeFromStartTime}, limit)
+}
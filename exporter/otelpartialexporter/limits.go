@@ -0,0 +1,139 @@
+package otelpartialexporter
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// LimitsConfig limits the size of the stored spans. Spans over the limits are truncated
+// before they are stored, and the dropped attributes, events and links are counted on the span.
+// Zero values disable the limits.
+type LimitsConfig struct {
+	// MaxSpanSize is the maximum size of the serialized trace holding the span, in bytes.
+	// Events, links and then span attributes are dropped until the trace fits, and the heartbeat
+	// is dropped if it still doesn't.
+	MaxSpanSize int `mapstructure:"max_span_size"`
+	// MaxAttributes is the maximum number of attributes of the span and of each of its events.
+	MaxAttributes int `mapstructure:"max_attributes"`
+	// MaxEvents is the maximum number of events of the span. The most recent events are kept.
+	MaxEvents int `mapstructure:"max_events"`
+	// MaxAttributeValueLength is the maximum length of string and bytes attribute values,
+	// including the resource attributes, in bytes.
+	MaxAttributeValueLength int `mapstructure:"max_attribute_value_length"`
+}
+
+func (c *LimitsConfig) Validate() error {
+	if c.MaxSpanSize < 0 || c.MaxAttributes < 0 || c.MaxEvents < 0 || c.MaxAttributeValueLength < 0 {
+		return errors.New("limits cannot be negative")
+	}
+	return nil
+}
+
+// apply truncates the single span trace to the limits. It reports false if the
+// trace is still over the maximum size after the truncation.
+func (c *LimitsConfig) apply(trace ptrace.Traces) bool {
+	rs := trace.ResourceSpans().At(0)
+	span := rs.ScopeSpans().At(0).Spans().At(0)
+
+	truncateValues(rs.Resource().Attributes(), c.MaxAttributeValueLength)
+
+	dropped := truncateAttributes(span.Attributes(), c.MaxAttributes, c.MaxAttributeValueLength)
+	span.SetDroppedAttributesCount(span.DroppedAttributesCount() + uint32(dropped))
+
+	events := span.Events()
+	if c.MaxEvents > 0 && events.Len() > c.MaxEvents {
+		// events are appended in order, so the oldest ones are dropped
+		toDrop := events.Len() - c.MaxEvents
+		i := 0
+		events.RemoveIf(func(ptrace.SpanEvent) bool {
+			i++
+			return i <= toDrop
+		})
+		span.SetDroppedEventsCount(span.DroppedEventsCount() + uint32(toDrop))
+	}
+
+	for i := range events.Len() {
+		event := events.At(i)
+		dropped := truncateAttributes(event.Attributes(), c.MaxAttributes, c.MaxAttributeValueLength)
+		event.SetDroppedAttributesCount(event.DroppedAttributesCount() + uint32(dropped))
+	}
+
+	if c.MaxSpanSize <= 0 || tracesProtoMarshaler.TracesSize(trace) <= c.MaxSpanSize {
+		return true
+	}
+
+	span.SetDroppedEventsCount(span.DroppedEventsCount() + uint32(span.Events().Len()))
+	span.Events().RemoveIf(func(ptrace.SpanEvent) bool { return true })
+	if tracesProtoMarshaler.TracesSize(trace) <= c.MaxSpanSize {
+		return true
+	}
+
+	span.SetDroppedLinksCount(span.DroppedLinksCount() + uint32(span.Links().Len()))
+	span.Links().RemoveIf(func(ptrace.SpanLink) bool { return true })
+	if tracesProtoMarshaler.TracesSize(trace) <= c.MaxSpanSize {
+		return true
+	}
+
+	span.SetDroppedAttributesCount(span.DroppedAttributesCount() + uint32(span.Attributes().Len()))
+	span.Attributes().Clear()
+	return tracesProtoMarshaler.TracesSize(trace) <= c.MaxSpanSize
+}
+
+// truncateAttributes keeps the first maxCount attributes and truncates their values
+// to maxValueLength. It returns the number of dropped attributes.
+func truncateAttributes(attrs pcommon.Map, maxCount, maxValueLength int) int {
+	var dropped int
+	if maxCount > 0 && attrs.Len() > maxCount {
+		kept := 0
+		attrs.RemoveIf(func(string, pcommon.Value) bool {
+			if kept < maxCount {
+				kept++
+				return false
+			}
+			dropped++
+			return true
+		})
+	}
+
+	truncateValues(attrs, maxValueLength)
+	return dropped
+}
+
+func truncateValues(attrs pcommon.Map, maxLength int) {
+	if maxLength <= 0 {
+		return
+	}
+	for _, v := range attrs.All() {
+		truncateValue(v, maxLength)
+	}
+}
+
+func truncateValue(v pcommon.Value, maxLength int) {
+	switch v.Type() {
+	case pcommon.ValueTypeStr:
+		if len(v.Str()) > maxLength {
+			v.SetStr(truncateString(v.Str(), maxLength))
+		}
+	case pcommon.ValueTypeBytes:
+		if v.Bytes().Len() > maxLength {
+			v.Bytes().FromRaw(v.Bytes().AsRaw()[:maxLength])
+		}
+	case pcommon.ValueTypeSlice:
+		for _, elem := range v.Slice().All() {
+			truncateValue(elem, maxLength)
+		}
+	case pcommon.ValueTypeMap:
+		truncateValues(v.Map(), maxLength)
+	}
+}
+
+// truncateString truncates the string to at most maxLength bytes without splitting a rune.
+func truncateString(s string, maxLength int) string {
+	for maxLength > 0 && !utf8.RuneStart(s[maxLength]) {
+		maxLength--
+	}
+	return s[:maxLength]
+}
@@ -0,0 +1,88 @@
+package otelpartialexporter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func newLimitsTestTrace() (ptrace.Traces, ptrace.Span) {
+	trace := ptrace.NewTraces()
+	rs := trace.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", strings.Repeat("s", 20))
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	for i := range 5 {
+		span.Attributes().PutStr(fmt.Sprintf("attr.%d", i), strings.Repeat("a", 20))
+	}
+	for i := range 5 {
+		event := span.Events().AppendEmpty()
+		event.SetName(fmt.Sprintf("event.%d", i))
+		event.Attributes().PutStr("key", "value")
+	}
+	span.Links().AppendEmpty()
+	return trace, span
+}
+
+func TestLimitsApply(t *testing.T) {
+	t.Run("counts", func(t *testing.T) {
+		trace, span := newLimitsTestTrace()
+		cfg := LimitsConfig{MaxAttributes: 3, MaxEvents: 2, MaxAttributeValueLength: 10}
+
+		require.True(t, cfg.apply(trace))
+		assert.Equal(t, 3, span.Attributes().Len())
+		assert.Equal(t, uint32(2), span.DroppedAttributesCount())
+		v, ok := span.Attributes().Get("attr.0")
+		require.True(t, ok)
+		assert.Equal(t, strings.Repeat("a", 10), v.Str())
+
+		require.Equal(t, 2, span.Events().Len())
+		assert.Equal(t, "event.3", span.Events().At(0).Name())
+		assert.Equal(t, uint32(3), span.DroppedEventsCount())
+
+		serviceName, _ := trace.ResourceSpans().At(0).Resource().Attributes().Get("service.name")
+		assert.Equal(t, strings.Repeat("s", 10), serviceName.Str())
+	})
+
+	t.Run("size", func(t *testing.T) {
+		trace, span := newLimitsTestTrace()
+		full := tracesProtoMarshaler.TracesSize(trace)
+
+		// dropping the events is enough
+		cfg := LimitsConfig{MaxSpanSize: full - 10}
+		require.True(t, cfg.apply(trace))
+		assert.Equal(t, 0, span.Events().Len())
+		assert.Equal(t, uint32(5), span.DroppedEventsCount())
+		assert.Equal(t, 1, span.Links().Len())
+		assert.Equal(t, 5, span.Attributes().Len())
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		trace, span := newLimitsTestTrace()
+		cfg := LimitsConfig{MaxSpanSize: 10}
+
+		assert.False(t, cfg.apply(trace))
+		assert.Equal(t, uint32(5), span.DroppedAttributesCount())
+		assert.Equal(t, uint32(1), span.DroppedLinksCount())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		trace, span := newLimitsTestTrace()
+		cfg := LimitsConfig{}
+
+		require.True(t, cfg.apply(trace))
+		assert.Equal(t, 5, span.Attributes().Len())
+		assert.Equal(t, 5, span.Events().Len())
+	})
+}
+
+func TestTruncateString(t *testing.T) {
+	assert.Equal(t, "abc", truncateString("abcdef", 3))
+	// the two bytes rune doesn't fit
+	assert.Equal(t, "a", truncateString("aéb", 2))
+	assert.Equal(t, "aé", truncateString("aéb", 3))
+}
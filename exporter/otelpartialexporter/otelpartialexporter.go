@@ -2,10 +2,8 @@ package otelpartialexporter
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
-	"strings"
 	"time"
 
 	"go.opentelemetry.io/collector/component"
@@ -16,47 +14,65 @@ import (
 	"go.opentelemetry.io/collector/pdata/plog"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 
+	"github.com/G-Research/otel-partial-collector/internal/partial"
 	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"github.com/G-Research/otel-partial-collector/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 var typeStr = component.MustNewType("otelpartialexporter")
 
-var (
-	tracesProtoUnmarshaler base64ProtoUnmarshaler
-	tracesProtoMarshaler   ptrace.ProtoMarshaler
-	tracesJSONUnmarshaler  ptrace.JSONUnmarshaler
-)
-
-type base64ProtoUnmarshaler struct{}
+const meterName = "github.com/G-Research/otel-partial-collector/exporter/otelpartialexporter"
 
-func (*base64ProtoUnmarshaler) UnmarshalTraces(buf []byte) (ptrace.Traces, error) {
-	rawTrace, err := base64.StdEncoding.DecodeString(string(buf))
-	if err != nil {
-		return ptrace.Traces{}, fmt.Errorf("failed to base64 decode: %w", err)
-	}
-
-	var u ptrace.ProtoUnmarshaler
-	traces, err := u.UnmarshalTraces(rawTrace)
-	if err != nil {
-		return ptrace.Traces{}, fmt.Errorf("failed to unmarshal traces: %w", err)
-	}
+var tracesProtoMarshaler ptrace.ProtoMarshaler
 
-	return traces, nil
+// store is the subset of the postgres.ShardedDB used by the exporter.
+type store interface {
+	quotaStore
+	PutTrace(ctx context.Context, partialTrace *postgres.PartialTrace) error
+	RemoveTrace(ctx context.Context, tenant, traceID, spanID string) error
+	TouchTombstone(ctx context.Context, tenant, traceID, spanID string, expiresAt time.Time, expiresAfter time.Duration) (*postgres.Tombstone, error)
+	RemoveTombstone(ctx context.Context, tenant, traceID, spanID string) error
+	Ping(ctx context.Context) error
+	Close() error
 }
 
 type otelPartialExporter struct {
-	db           *postgres.DB
+	db           store
 	expiryFactor int
-
+	tenant       TenantConfig
+	quota        *quota
+	limits       LimitsConfig
+	lifetime     lifetimeLimit
+	clock        partial.Clock
+	heartbeat    heartbeatTime
+	// resurrections is set to look up the tombstones of all the spans, not only of the
+	// spans emitted at the end of their lifetime
+	resurrections bool
+	versions      *versions
+	telemetry     *telemetry
+	health        *partial.HealthReporter
+
+	tracer trace.Tracer
 	logger *zap.Logger
 
 	cancelFunc context.CancelFunc
-	component.StartFunc
+}
+
+// pingInterval is the interval of the pings reporting the status of the database.
+const pingInterval = 10 * time.Second
+
+func (e *otelPartialExporter) Start(_ context.Context, host component.Host) error {
+	e.health.Start(host)
+	return nil
 }
 
 func (e *otelPartialExporter) Shutdown(context.Context) error {
 	e.logger.Info("Shutting down otel partial exporter")
+	e.health.Shutdown()
 	if e.cancelFunc != nil {
 		e.cancelFunc()
 	}
@@ -64,7 +80,19 @@ func (e *otelPartialExporter) Shutdown(context.Context) error {
 }
 
 func (e *otelPartialExporter) consumeLogs(ctx context.Context, logs plog.Logs) error {
+	if !e.health.Connected() {
+		// the error is not permanent, so the batch is retried until the database is reached
+		return fmt.Errorf("failed to export partial spans: %w", e.health.Err())
+	}
+
 	now := time.Now().UTC()
+	e.telemetry.batchSize.Record(ctx, int64(logs.LogRecordCount()))
+
+	ctx, span := e.tracer.Start(ctx, "consumeLogs", trace.WithAttributes(
+		attribute.Int("log_records", logs.LogRecordCount()),
+	))
+	defer span.End()
+
 	var errs []error
 	resourceLogs := logs.ResourceLogs()
 	for i := range resourceLogs.Len() {
@@ -75,67 +103,25 @@ func (e *otelPartialExporter) consumeLogs(ctx context.Context, logs plog.Logs) e
 			records := scopeLogs.At(j).LogRecords()
 			for k := range records.Len() {
 				logRecord := records.At(k)
-				logAttrs := logRecord.Attributes()
-
-				eventType, err := getEventTypeFromAttributes(logAttrs)
-				if err != nil {
-					e.logger.Warn("Failed to resolve event type", zap.Error(err))
+				if !e.versions.accept(ctx, logRecord, resourceAttrs) {
+					e.telemetry.recordDropped(ctx, dropReasonVersionNotAccepted)
 					continue
 				}
 
-				unmarshaler, ok := getUnmrashaler(logAttrs)
-				if !ok {
-					e.logger.Warn("Failed to resolve unmarshaler type")
-					continue
-				}
-
-				traces, err := unmarshaler.UnmarshalTraces([]byte(logRecord.Body().AsString()))
+				msg, err := protocol.Decode(logRecord)
 				if err != nil {
-					return fmt.Errorf("failed to unmarshal traces: %w", err)
+					// a record failing to decode fails again when retried, so only the record is dropped
+					e.telemetry.recordDropped(ctx, dropReason(err))
+					e.logger.Warn("Failed to decode log record", zap.Error(err))
+					continue
 				}
+				e.telemetry.recordProcessed(ctx, msg.Event)
 
-				switch eventType {
-				case EventTypeHeartbeat:
-					// if heartbeat, get the frequency
-					interval, err := getHeartbeatIntervalFromAttributes(logAttrs)
-					if err != nil {
-						e.logger.Warn("Failed to resolve heartbeat frequency", zap.Error(err))
-						continue
-					}
-
-					for _, t := range flattenTraces(traces) {
-						mergeAttributes(t.ResourceSpans().At(0).Resource().Attributes(), resourceAttrs)
-						span := t.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
-
-						b, err := tracesProtoMarshaler.MarshalTraces(t)
-						if err != nil {
-							errs = append(errs, fmt.Errorf("failed to marshal trace %v: %w", t, err))
-							continue
-						}
-
-						if err := e.db.PutTrace(
-							ctx,
-							&postgres.PartialTrace{
-								TraceID:   span.TraceID().String(),
-								SpanID:    span.SpanID().String(),
-								Trace:     b,
-								Timestamp: now,
-								ExpiresAt: now.Add(interval * time.Duration(e.expiryFactor)),
-							},
-						); err != nil {
-							errs = append(errs, fmt.Errorf("failed to put trace: %w", err))
-							continue
-						}
-					}
-				case EventTypeStop:
-					for _, t := range flattenTraces(traces) {
-						span := t.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
-						if err := e.db.RemoveTrace(ctx, span.TraceID().String(), span.SpanID().String()); err != nil {
-							errs = append(errs, fmt.Errorf("failed to remove trace: %w", err))
-							continue
-						}
-					}
-
+				switch msg.Event {
+				case protocol.EventTypeHeartbeat:
+					errs = append(errs, e.putTraces(ctx, msg, resourceAttrs, e.heartbeat.time(logRecord, now))...)
+				case protocol.EventTypeStop:
+					errs = append(errs, e.removeTraces(ctx, msg, resourceAttrs)...)
 				default:
 					// assertion
 					panic("unreachable")
@@ -144,20 +130,228 @@ func (e *otelPartialExporter) consumeLogs(ctx context.Context, logs plog.Logs) e
 		}
 	}
 
-	return errors.Join(errs...)
+	err := errors.Join(errs...)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// write times the database write and reports its outcome as the status of the exporter.
+func (e *otelPartialExporter) write(ctx context.Context, operation string, f func() error) error {
+	err := e.telemetry.timeDBWrite(ctx, operation, f)
+	e.health.Observe(err)
+	return err
+}
+
+// putTraces stores the partial spans of a heartbeat, with now as the time of the heartbeat.
+func (e *otelPartialExporter) putTraces(ctx context.Context, msg protocol.Message, resourceAttrs pcommon.Map, now time.Time) []error {
+	traces := partial.FlattenTraces(msg.Traces)
+	ctx, tspan := e.tracer.Start(ctx, "PutTraces", trace.WithAttributes(
+		attribute.Int("spans", len(traces)),
+	))
+	defer tspan.End()
+
+	var errs []error
+	var stored int
+	for _, t := range traces {
+		traceResourceAttrs := t.ResourceSpans().At(0).Resource().Attributes()
+		partial.MergeAttributes(traceResourceAttrs, resourceAttrs)
+		span := t.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+		var serviceName string
+		if v, ok := traceResourceAttrs.Get("service.name"); ok {
+			serviceName = v.AsString()
+		}
+
+		if !e.limits.apply(t) {
+			e.telemetry.recordDropped(ctx, dropReasonTooLarge)
+			e.logger.Warn(
+				"Dropped heartbeat of a partial span over the maximum size",
+				zap.String("trace_id", span.TraceID().String()),
+				zap.String("span_id", span.SpanID().String()),
+				zap.Int("max_span_size", e.limits.MaxSpanSize),
+			)
+			continue
+		}
+
+		b, err := tracesProtoMarshaler.MarshalTraces(t)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to marshal trace %v: %w", t, err))
+			continue
+		}
+
+		pt := &postgres.PartialTrace{
+			Tenant:            e.tenant.tenant(ctx, traceResourceAttrs),
+			TraceID:           span.TraceID().String(),
+			SpanID:            span.SpanID().String(),
+			Trace:             b,
+			HeartbeatInterval: msg.HeartbeatInterval,
+			ServiceName:       serviceName,
+			SpanName:          span.Name(),
+			StartTime:         span.StartTimestamp().AsTime(),
+			// the log records are not received in order
+			IfNewer: e.heartbeat.fromRecord(),
+		}
+		expiresAfter := msg.HeartbeatInterval * time.Duration(e.expiryFactor)
+		if e.clock == partial.ClockDatabase {
+			// the database computes the times from its own clock
+			pt.ExpiresAfter = expiresAfter
+			if e.lifetime.fromFirstHeartbeat(span.StartTimestamp()) {
+				pt.LifetimeExpiresAfter = e.lifetime.max
+			} else {
+				pt.LifetimeExpiresAt = e.lifetime.expiresAt(span.StartTimestamp(), now)
+			}
+		} else {
+			pt.Timestamp = now
+			pt.ExpiresAt = now.Add(expiresAfter)
+			pt.LifetimeExpiresAt = e.lifetime.expiresAt(span.StartTimestamp(), now)
+		}
+
+		if e.tombstones() {
+			// spans emitted by the receiver keep a tombstone as long as they are still heartbeating
+			var tombstone *postgres.Tombstone
+			err := e.write(ctx, "touch_tombstone", func() (err error) {
+				tombstone, err = e.db.TouchTombstone(ctx, pt.Tenant, pt.TraceID, pt.SpanID, pt.ExpiresAt, pt.ExpiresAfter)
+				return err
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to check tombstone: %w", err))
+				continue
+			}
+			if tombstone != nil {
+				// spans emitted at the end of their lifetime are not stored again
+				if tombstone.Reason == string(partial.GCReasonMaxLifetime) {
+					continue
+				}
+				// other spans were only thought dead and are emitted again marked as resurrected
+				pt.PreviousGCReason = tombstone.Reason
+				pt.PreviousGCAt = tombstone.CreatedAt
+			}
+		}
+
+		// the timestamp is zero with the database clock
+		admitted, err := e.quota.admit(ctx, pt, pt.Timestamp)
+		if err != nil {
+			e.health.Observe(err)
+			errs = append(errs, fmt.Errorf("failed to enforce quota: %w", err))
+			continue
+		}
+		if !admitted {
+			continue
+		}
+
+		if err := e.write(ctx, "put_trace", func() error {
+			return e.db.PutTrace(ctx, pt)
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to put trace: %w", err))
+			continue
+		}
+		e.telemetry.payloadSize.Record(ctx, int64(len(pt.Trace)))
+		stored++
+	}
+
+	tspan.SetAttributes(attribute.Int("rows", stored))
+	if len(errs) > 0 {
+		tspan.SetStatus(codes.Error, errors.Join(errs...).Error())
+	}
+	return errs
+}
+
+// tombstones reports whether the tombstones of the spans emitted by the receiver are looked up.
+func (e *otelPartialExporter) tombstones() bool {
+	return e.lifetime.max > 0 || e.resurrections
+}
+
+// removeTraces removes the partial spans of a stop.
+func (e *otelPartialExporter) removeTraces(ctx context.Context, msg protocol.Message, resourceAttrs pcommon.Map) []error {
+	traces := partial.FlattenTraces(msg.Traces)
+	ctx, tspan := e.tracer.Start(ctx, "RemoveTraces", trace.WithAttributes(
+		attribute.Int("spans", len(traces)),
+	))
+	defer tspan.End()
+
+	var errs []error
+	var removed int
+	for _, t := range traces {
+		span := t.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+		tenant := e.tenant.tenant(ctx, t.ResourceSpans().At(0).Resource().Attributes(), resourceAttrs)
+		if err := e.write(ctx, "remove_trace", func() error {
+			return e.db.RemoveTrace(ctx, tenant, span.TraceID().String(), span.SpanID().String())
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove trace: %w", err))
+			continue
+		}
+		if e.tombstones() {
+			if err := e.write(ctx, "remove_tombstone", func() error {
+				return e.db.RemoveTombstone(ctx, tenant, span.TraceID().String(), span.SpanID().String())
+			}); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove tombstone: %w", err))
+				continue
+			}
+		}
+		removed++
+	}
+
+	tspan.SetAttributes(attribute.Int("rows", removed))
+	if len(errs) > 0 {
+		tspan.SetStatus(codes.Error, errors.Join(errs...).Error())
+	}
+	return errs
 }
 
 func newPartialExporter(ctx context.Context, settings exporter.Settings, baseCfg component.Config) (exporter.Logs, error) {
 	cfg := baseCfg.(*Config)
-	db, err := postgres.NewDB(ctx, cfg.Postgres)
+	shards, err := postgres.ResolveShards(cfg.Postgres, cfg.Shards)
+	if err != nil {
+		return nil, err
+	}
+
+	lifetime, err := cfg.Lifetime.limit()
+	if err != nil {
+		return nil, err
+	}
+
+	heartbeat, err := cfg.HeartbeatTime.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	tel, err := newTelemetry(settings.MeterProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := postgres.NewShardedDB(
+		ctx,
+		shards,
+		postgres.WithTracerProvider(settings.TracerProvider),
+		// the database is connected in the background after the start, see partial.HealthReporter
+		postgres.WithLazyConnect(),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new db connection: %w", err)
 	}
 
 	ex := &otelPartialExporter{
-		db:           db,
-		expiryFactor: cfg.ExpiryFactor,
-		logger:       settings.Logger,
+		db:            db,
+		expiryFactor:  cfg.ExpiryFactor,
+		tenant:        cfg.Tenant,
+		limits:        cfg.Limits,
+		lifetime:      lifetime,
+		clock:         cfg.Clock,
+		heartbeat:     heartbeat,
+		resurrections: cfg.DetectResurrections,
+		versions:      newVersions(cfg.Protocol, tel.protocolRecords, settings.Logger),
+		telemetry:     tel,
+		health:        partial.NewHealthReporter(db, pingInterval),
+		quota: &quota{
+			cfg:    cfg.Quota,
+			store:  db,
+			hits:   tel.quotaHits,
+			logger: settings.Logger,
+		},
+		tracer: settings.TracerProvider.Tracer(meterName),
+		logger: settings.Logger,
 	}
 
 	return exporterhelper.NewLogs(
@@ -166,6 +360,8 @@ func newPartialExporter(ctx context.Context, settings exporter.Settings, baseCfg
 		baseCfg,
 		ex.consumeLogs,
 		exporterhelper.WithCapabilities(consumer.Capabilities{MutatesData: true}),
+		exporterhelper.WithStart(ex.Start),
+		exporterhelper.WithShutdown(ex.Shutdown),
 	)
 }
 
@@ -180,133 +376,11 @@ func NewFactory() exporter.Factory {
 	)
 }
 
-func flattenTraces(traces ptrace.Traces) []ptrace.Traces {
-	spanCount := traces.SpanCount()
-	if spanCount == 1 {
-		return []ptrace.Traces{traces}
-	}
-
-	newTraces := make([]ptrace.Traces, 0, spanCount)
-	resourceSpans := traces.ResourceSpans()
-	for i := range resourceSpans.Len() {
-		resourceSpan := resourceSpans.At(i)
-		resource := resourceSpan.Resource()
-		scopeSpans := resourceSpan.ScopeSpans()
-		for j := range scopeSpans.Len() {
-			scopeSpan := scopeSpans.At(j)
-			scope := scopeSpan.Scope()
-			spans := scopeSpan.Spans()
-			for k := range spans.Len() {
-				span := spans.At(k)
-
-				newTrace := ptrace.NewTraces()
-				newResourceSpans := newTrace.ResourceSpans()
-				newResourceSpan := newResourceSpans.AppendEmpty()
-				newResourceSpan.SetSchemaUrl(resourceSpan.SchemaUrl())
-				newResource := newResourceSpan.Resource()
-				resource.CopyTo(newResource)
-				newScopeSpans := newResourceSpan.ScopeSpans()
-				newScopeSpan := newScopeSpans.AppendEmpty()
-				newScopeSpan.SetSchemaUrl(scopeSpan.SchemaUrl())
-				newScope := newScopeSpan.Scope()
-				scope.CopyTo(newScope)
-				newSpans := newScopeSpan.Spans()
-				newSpan := newSpans.AppendEmpty()
-				span.CopyTo(newSpan)
-
-				newTraces = append(newTraces, newTrace)
-			}
-		}
-	}
-
-	return newTraces
-}
-
-type EventType int
+// EventType is kept for compatibility, see protocol.EventType.
+type EventType = protocol.EventType
 
 const (
-	EventTypeUnknown = iota
-	EventTypeHeartbeat
-	EventTypeStop
+	EventTypeUnknown   = protocol.EventTypeUnknown
+	EventTypeHeartbeat = protocol.EventTypeHeartbeat
+	EventTypeStop      = protocol.EventTypeStop
 )
-
-func getEventTypeFromAttributes(attrs pcommon.Map) (EventType, error) {
-	v, ok := attrs.Get("partial.event")
-	if !ok {
-		return EventTypeUnknown, errors.New("unknown event type: empty")
-	}
-	switch t := v.AsString(); t {
-	case "heartbeat":
-		return EventTypeHeartbeat, nil
-	case "stop":
-		return EventTypeStop, nil
-	default:
-		return EventTypeUnknown, fmt.Errorf("unknown event type: %q", t)
-	}
-}
-
-func getUnmrashaler(attrs pcommon.Map) (ptrace.Unmarshaler, bool) {
-	ty, ok := attrs.Get("partial.body.type")
-	if !ok {
-		return &tracesProtoUnmarshaler, true
-	}
-
-	switch ty.AsString() {
-	case "proto":
-		return &tracesProtoUnmarshaler, true
-	case "json/v1":
-		return &tracesJSONUnmarshaler, true
-	default:
-		return nil, false
-	}
-}
-
-func getHeartbeatIntervalFromAttributes(attrs pcommon.Map) (time.Duration, error) {
-	freq, ok := attrs.Get("partial.frequency")
-	if !ok {
-		return 0, errors.New("frequency is not set")
-	}
-	d, err := time.ParseDuration(freq.AsString())
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse duration: %w", err)
-	}
-	return d, nil
-}
-
-func mergeAttributes(dst pcommon.Map, sources ...pcommon.Map) {
-	for _, src := range sources {
-		src.Range(func(k string, v pcommon.Value) bool {
-			if strings.HasPrefix(k, "partial.") {
-				return true
-			}
-
-			_, ok := dst.Get(k)
-			if ok {
-				return true
-			}
-
-			switch v.Type() {
-			case pcommon.ValueTypeBool:
-				dst.PutBool(k, v.Bool())
-			case pcommon.ValueTypeBytes:
-				bytes := dst.PutEmptyBytes(k)
-				v.Bytes().MoveTo(bytes)
-			case pcommon.ValueTypeDouble:
-				dst.PutDouble(k, v.Double())
-			case pcommon.ValueTypeInt:
-				dst.PutInt(k, v.Int())
-			case pcommon.ValueTypeMap:
-				m := dst.PutEmptyMap(k)
-				v.Map().MoveTo(m)
-			case pcommon.ValueTypeStr:
-				dst.PutStr(k, v.Str())
-			case pcommon.ValueTypeEmpty:
-				dst.PutEmpty(k)
-			case pcommon.ValueTypeSlice:
-				s := dst.PutEmptySlice(k)
-				v.Slice().MoveAndAppendTo(s)
-			}
-			return true
-		})
-	}
-}
@@ -1,96 +1,298 @@
 package otelpartialexporter
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componentstatus"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"github.com/G-Research/otel-partial-collector/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
 )
 
-func TestMergeAttributes(t *testing.T) {
-	dst := pcommon.NewMap()
-	dst.PutStr("stays", "no_override")
-
-	src := pcommon.NewMap()
-	// "stays is already applied on the destination, so it shouldn't be overwritten"
-	src.PutStr("stays", "override")
-	// "partial." should be ignored
-	src.PutBool("partial.ignored", true)
-
-	appliedPrimitiveAttributes := map[string]any{
-		"applied.int":    int64(1),
-		"applied.double": 1.1,
-		"applied.bool":   true,
-		"applied.str":    "str",
+type fakeStore struct {
+	fakeQuotaStore
+	traces     map[string]*postgres.PartialTrace
+	tombstones map[string]*postgres.Tombstone
+}
+
+func (s *fakeStore) PutTrace(_ context.Context, partialTrace *postgres.PartialTrace) error {
+	s.traces[partialTrace.TraceID+partialTrace.SpanID] = partialTrace
+	return nil
+}
+
+func (s *fakeStore) RemoveTrace(_ context.Context, _, traceID, spanID string) error {
+	delete(s.traces, traceID+spanID)
+	return nil
+}
+
+func (s *fakeStore) TouchTombstone(_ context.Context, _, traceID, spanID string, _ time.Time, _ time.Duration) (*postgres.Tombstone, error) {
+	return s.tombstones[traceID+spanID], nil
+}
+
+func (s *fakeStore) RemoveTombstone(_ context.Context, _, traceID, spanID string) error {
+	delete(s.tombstones, traceID+spanID)
+	return nil
+}
+
+func (s *fakeStore) Ping(context.Context) error {
+	return nil
+}
+
+func (s *fakeStore) Close() error {
+	return nil
+}
+
+func newTestExporter(t *testing.T, db store, meterProvider metric.MeterProvider) *otelPartialExporter {
+	t.Helper()
+	tel, err := newTelemetry(meterProvider)
+	require.NoError(t, err)
+
+	// the database of the tests is connected without starting the exporter
+	health := partial.NewHealthReporter(db, time.Hour)
+	health.Observe(nil)
+
+	return &otelPartialExporter{
+		db:           db,
+		expiryFactor: 3,
+		quota:        &quota{store: db, hits: tel.quotaHits, logger: zap.NewNop()},
+		versions:     newVersions(ProtocolConfig{AcceptedVersions: protocol.SupportedVersions}, tel.protocolRecords, zap.NewNop()),
+		telemetry:    tel,
+		health:       health,
+		tracer:       tracenoop.NewTracerProvider().Tracer(meterName),
+		logger:       zap.NewNop(),
 	}
+}
+
+func TestConsumeLogsAcceptedVersions(t *testing.T) {
+	db := &fakeStore{traces: map[string]*postgres.PartialTrace{}}
+	e := newTestExporter(t, db, noop.NewMeterProvider())
+	e.versions.accepted = map[protocol.Version]bool{protocol.Version2: true}
 
-	for k, v := range appliedPrimitiveAttributes {
-		switch v := v.(type) {
-		case int64:
-			src.PutInt(k, v)
-		case float64:
-			src.PutDouble(k, v)
-		case string:
-			src.PutStr(k, v)
-		case bool:
-			src.PutBool(k, v)
-		}
+	logs := plog.NewLogs()
+	records := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	for i, version := range protocol.SupportedVersions {
+		traces := ptrace.NewTraces()
+		span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+		span.SetTraceID([16]byte{1})
+		span.SetSpanID([8]byte{byte(i + 1)})
+
+		msg := protocol.Message{Version: version, Event: protocol.EventTypeHeartbeat, HeartbeatInterval: time.Second, Traces: traces}
+		require.NoError(t, protocol.Encode(msg, records.AppendEmpty()))
 	}
 
-	appliedMap := pcommon.NewMap()
-	appliedMap.PutBool("applied.map.bool", true)
-	{
-		m := src.PutEmptyMap("applied.map")
-		appliedMap.CopyTo(m)
+	require.NoError(t, e.consumeLogs(context.Background(), logs))
+	require.Len(t, db.traces, 1)
+	for _, pt := range db.traces {
+		assert.Equal(t, "0200000000000000", pt.SpanID)
 	}
+}
 
-	appliedSlice := pcommon.NewSlice()
-	err := appliedSlice.FromRaw([]any{1, 2, 3})
-	require.NoError(t, err)
-	{
-		s := src.PutEmptySlice("applied.slice")
-		appliedSlice.CopyTo(s)
+func TestConsumeLogsSpans(t *testing.T) {
+	db := &fakeStore{traces: map[string]*postgres.PartialTrace{}}
+	e := newTestExporter(t, db, noop.NewMeterProvider())
+	recorder := tracetest.NewSpanRecorder()
+	e.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer(meterName)
+
+	traces := ptrace.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	for i := range 2 {
+		span := spans.AppendEmpty()
+		span.SetTraceID([16]byte{1})
+		span.SetSpanID([8]byte{byte(i + 1)})
 	}
 
-	appliedByteSlice := pcommon.NewByteSlice()
-	appliedByteSlice.Append(1, 2, 3)
-	{
-		s := src.PutEmptyBytes("applied.bytes")
-		appliedByteSlice.CopyTo(s)
+	logs := plog.NewLogs()
+	records := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	for _, msg := range []protocol.Message{
+		{Event: protocol.EventTypeHeartbeat, HeartbeatInterval: time.Second, Traces: traces},
+		{Event: protocol.EventTypeStop, Traces: traces},
+	} {
+		require.NoError(t, protocol.Encode(msg, records.AppendEmpty()))
 	}
+	require.NoError(t, e.consumeLogs(context.Background(), logs))
 
-	src.PutEmpty("applied.empty")
+	ended := recorder.Ended()
+	require.Len(t, ended, 3)
+	root := ended[2]
+	assert.Equal(t, "consumeLogs", root.Name())
+	assert.Contains(t, root.Attributes(), attribute.Int("log_records", 2))
+	for i, name := range []string{"PutTraces", "RemoveTraces"} {
+		assert.Equal(t, name, ended[i].Name())
+		assert.Equal(t, root.SpanContext().SpanID(), ended[i].Parent().SpanID())
+		assert.Contains(t, ended[i].Attributes(), attribute.Int("spans", 2))
+		assert.Contains(t, ended[i].Attributes(), attribute.Int("rows", 2))
+	}
+}
 
-	mergeAttributes(dst, src)
+// statusHost records the statuses reported by the exporter.
+type statusHost struct {
+	component.Host
+	statuses []componentstatus.Status
+}
 
-	val, ok := dst.Get("stays")
-	assert.True(t, ok)
-	assert.Equal(t, "no_override", val.AsString())
+func (h *statusHost) Report(ev *componentstatus.Event) {
+	h.statuses = append(h.statuses, ev.Status())
+}
 
-	_, ok = dst.Get("partial.ignored")
-	assert.False(t, ok)
+// unreachableStore fails the writes while err is set.
+type unreachableStore struct {
+	fakeStore
+	err error
+}
 
-	for k, v := range appliedPrimitiveAttributes {
-		val, ok = dst.Get(k)
-		assert.True(t, ok)
-		assert.Equal(t, v, val.AsRaw())
+func (s *unreachableStore) PutTrace(ctx context.Context, partialTrace *postgres.PartialTrace) error {
+	if s.err != nil {
+		return s.err
 	}
+	return s.fakeStore.PutTrace(ctx, partialTrace)
+}
+
+func TestConsumeLogsReportsStatus(t *testing.T) {
+	db := &unreachableStore{
+		fakeStore: fakeStore{traces: map[string]*postgres.PartialTrace{}},
+		err:       errors.New("connection refused"),
+	}
+	e := newTestExporter(t, db, noop.NewMeterProvider())
+	host := &statusHost{Host: componenttest.NewNopHost()}
+	require.NoError(t, e.Start(context.Background(), host))
+	defer func() {
+		require.NoError(t, e.Shutdown(context.Background()))
+	}()
+
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetTraceID([16]byte{1})
+	span.SetSpanID([8]byte{1})
+	logs := plog.NewLogs()
+	record := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	require.NoError(t, protocol.Encode(protocol.Message{Event: protocol.EventTypeHeartbeat, HeartbeatInterval: time.Second, Traces: traces}, record))
 
-	val, ok = dst.Get("applied.map")
-	assert.True(t, ok)
-	assert.Equal(t, appliedMap, val.Map())
+	assert.ErrorContains(t, e.consumeLogs(context.Background(), logs), "connection refused")
+	assert.Equal(t, []componentstatus.Status{componentstatus.StatusRecoverableError}, host.statuses)
+
+	db.err = nil
+	require.NoError(t, e.consumeLogs(context.Background(), logs))
+	assert.Equal(t, []componentstatus.Status{componentstatus.StatusRecoverableError, componentstatus.StatusOK}, host.statuses)
+}
+
+func TestConsumeLogsNotConnected(t *testing.T) {
+	db := &fakeStore{traces: map[string]*postgres.PartialTrace{}}
+	e := newTestExporter(t, db, noop.NewMeterProvider())
+	e.health = partial.NewHealthReporter(db, time.Hour)
+
+	err := e.consumeLogs(context.Background(), plog.NewLogs())
+	assert.ErrorIs(t, err, partial.ErrNotConnected)
+	assert.False(t, consumererror.IsPermanent(err))
+
+	require.NoError(t, e.Start(context.Background(), componenttest.NewNopHost()))
+	defer func() {
+		require.NoError(t, e.Shutdown(context.Background()))
+	}()
+	assert.Eventually(t, e.health.Connected, time.Second, time.Millisecond)
+	assert.NoError(t, e.consumeLogs(context.Background(), plog.NewLogs()))
+}
 
-	val, ok = dst.Get("applied.slice")
-	assert.True(t, ok)
-	assert.Equal(t, appliedSlice, val.Slice())
+func TestConsumeLogsDatabaseClock(t *testing.T) {
+	db := &fakeStore{traces: map[string]*postgres.PartialTrace{}}
+	e := newTestExporter(t, db, noop.NewMeterProvider())
+	e.clock = partial.ClockDatabase
+	e.lifetime = lifetimeLimit{max: time.Hour, from: LifetimeFromFirstHeartbeat}
 
-	val, ok = dst.Get("applied.bytes")
-	assert.True(t, ok)
-	assert.Equal(t, appliedByteSlice, val.Bytes())
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetTraceID([16]byte{1})
+	span.SetSpanID([8]byte{1})
+	logs := plog.NewLogs()
+	record := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	require.NoError(t, protocol.Encode(protocol.Message{Event: protocol.EventTypeHeartbeat, HeartbeatInterval: 10 * time.Second, Traces: traces}, record))
+	require.NoError(t, e.consumeLogs(context.Background(), logs))
+
+	// the times are left to the database
+	require.Len(t, db.traces, 1)
+	for _, pt := range db.traces {
+		assert.True(t, pt.Timestamp.IsZero())
+		assert.True(t, pt.ExpiresAt.IsZero())
+		assert.True(t, pt.LifetimeExpiresAt.IsZero())
+		assert.Equal(t, 30*time.Second, pt.ExpiresAfter)
+		assert.Equal(t, time.Hour, pt.LifetimeExpiresAfter)
+	}
+}
+
+func TestConsumeLogsHeartbeatTime(t *testing.T) {
+	db := &fakeStore{traces: map[string]*postgres.PartialTrace{}}
+	e := newTestExporter(t, db, noop.NewMeterProvider())
+	e.heartbeat = heartbeatTime{source: HeartbeatTimeTimestamp, maxSkew: time.Minute}
+
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetTraceID([16]byte{1})
+	span.SetSpanID([8]byte{1})
+	logs := plog.NewLogs()
+	record := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	require.NoError(t, protocol.Encode(protocol.Message{Event: protocol.EventTypeHeartbeat, HeartbeatInterval: 10 * time.Second, Traces: traces}, record))
+	timestamp := time.Now().UTC().Add(-20 * time.Second).Truncate(time.Microsecond)
+	record.SetTimestamp(pcommon.NewTimestampFromTime(timestamp))
+	require.NoError(t, e.consumeLogs(context.Background(), logs))
+
+	// the heartbeat is stored with the time of its log record, after the heartbeats received earlier
+	require.Len(t, db.traces, 1)
+	for _, pt := range db.traces {
+		assert.Equal(t, timestamp, pt.Timestamp.UTC())
+		assert.Equal(t, timestamp.Add(30*time.Second), pt.ExpiresAt.UTC())
+		assert.True(t, pt.IfNewer)
+	}
+}
+
+func TestConsumeLogsResurrection(t *testing.T) {
+	emittedAt := time.Now().UTC().Add(-time.Minute)
+	db := &fakeStore{
+		traces: map[string]*postgres.PartialTrace{},
+		tombstones: map[string]*postgres.Tombstone{
+			pcommon.TraceID([16]byte{1}).String() + pcommon.SpanID([8]byte{1}).String(): {Reason: "expired", CreatedAt: emittedAt},
+			pcommon.TraceID([16]byte{2}).String() + pcommon.SpanID([8]byte{2}).String(): {Reason: "max_lifetime", CreatedAt: emittedAt},
+		},
+	}
+	e := newTestExporter(t, db, noop.NewMeterProvider())
+	e.resurrections = true
+
+	logs := plog.NewLogs()
+	records := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	for _, id := range []byte{1, 2, 3} {
+		traces := ptrace.NewTraces()
+		span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+		span.SetTraceID([16]byte{id})
+		span.SetSpanID([8]byte{id})
+		require.NoError(t, protocol.Encode(protocol.Message{Event: protocol.EventTypeHeartbeat, HeartbeatInterval: 10 * time.Second, Traces: traces}, records.AppendEmpty()))
+	}
+	require.NoError(t, e.consumeLogs(context.Background(), logs))
 
-	val, ok = dst.Get("applied.empty")
-	assert.True(t, ok)
-	assert.Equal(t, pcommon.ValueTypeEmpty, val.Type())
+	// the span emitted at the end of its lifetime is not stored again
+	require.Len(t, db.traces, 2)
+	resurrected := db.traces[pcommon.TraceID([16]byte{1}).String()+pcommon.SpanID([8]byte{1}).String()]
+	require.NotNil(t, resurrected)
+	assert.Equal(t, "expired", resurrected.PreviousGCReason)
+	assert.Equal(t, emittedAt, resurrected.PreviousGCAt)
+	live := db.traces[pcommon.TraceID([16]byte{3}).String()+pcommon.SpanID([8]byte{3}).String()]
+	require.NotNil(t, live)
+	assert.Empty(t, live.PreviousGCReason)
 }
@@ -0,0 +1,128 @@
+package otelpartialexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// QuotaConfig limits the number of live partial spans, so a single service
+// heartbeating too many spans cannot fill the database for everyone.
+type QuotaConfig struct {
+	// MaxSpansPerService is the maximum number of live partial spans per service.name. Zero disables the limit.
+	MaxSpansPerService int64 `mapstructure:"max_spans_per_service"`
+	// MaxSpans is the maximum number of live partial spans. Zero disables the limit.
+	MaxSpans int64 `mapstructure:"max_spans"`
+	// Policy selects what happens to a new partial span over the quota. Valid values are "reject" and "evict".
+	Policy QuotaPolicy `mapstructure:"policy"`
+}
+
+type QuotaPolicy string
+
+const (
+	// QuotaPolicyReject drops the heartbeats of new partial spans over the quota.
+	QuotaPolicyReject QuotaPolicy = "reject"
+	// QuotaPolicyEvict expires the oldest partial spans early to make room for the new ones.
+	QuotaPolicyEvict QuotaPolicy = "evict"
+)
+
+func (c *QuotaConfig) Validate() error {
+	if c.MaxSpansPerService < 0 {
+		return errors.New("max spans per service cannot be negative")
+	}
+
+	if c.MaxSpans < 0 {
+		return errors.New("max spans cannot be negative")
+	}
+
+	switch c.Policy {
+	case QuotaPolicyReject, QuotaPolicyEvict:
+		return nil
+	default:
+		return fmt.Errorf("invalid quota policy: %q", c.Policy)
+	}
+}
+
+func (c *QuotaConfig) enabled() bool {
+	return c.MaxSpansPerService > 0 || c.MaxSpans > 0
+}
+
+// quotaStore is the subset of the postgres.DB used to enforce the quotas.
+type quotaStore interface {
+	TraceExists(ctx context.Context, tenant, traceID, spanID string) (bool, error)
+	CountQuotaUsage(ctx context.Context, serviceName string) (int64, int64, error)
+	EvictTraces(ctx context.Context, serviceName string, n int, timestamp time.Time) (int64, error)
+}
+
+// quota enforces the QuotaConfig before new partial spans are stored.
+// The usage is read before each new span and the span is stored afterwards,
+// outside of a transaction, so concurrent exporters can exceed the limits
+// by the number of spans stored meanwhile.
+type quota struct {
+	cfg    QuotaConfig
+	store  quotaStore
+	hits   metric.Int64Counter
+	logger *zap.Logger
+}
+
+// admit reports whether the partial span can be stored. Heartbeats of stored spans are always admitted.
+// The evicted spans expire at now, or at the time of the database when it is zero.
+func (q *quota) admit(ctx context.Context, pt *postgres.PartialTrace, now time.Time) (bool, error) {
+	if !q.cfg.enabled() {
+		return true, nil
+	}
+
+	exists, err := q.store.TraceExists(ctx, pt.Tenant, pt.TraceID, pt.SpanID)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return true, nil
+	}
+
+	service, total, err := q.store.CountQuotaUsage(ctx, pt.ServiceName)
+	if err != nil {
+		return false, err
+	}
+
+	if q.cfg.MaxSpansPerService > 0 && service >= q.cfg.MaxSpansPerService {
+		q.hits.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("quota", "service"),
+			attribute.String("policy", string(q.cfg.Policy)),
+			attribute.String("service.name", pt.ServiceName),
+		))
+		if q.cfg.Policy == QuotaPolicyReject {
+			q.logger.Debug("Partial span rejected by the service quota", zap.String("service.name", pt.ServiceName))
+			return false, nil
+		}
+
+		evicted, err := q.store.EvictTraces(ctx, pt.ServiceName, int(service-q.cfg.MaxSpansPerService+1), now)
+		if err != nil {
+			return false, err
+		}
+		total -= evicted
+	}
+
+	if q.cfg.MaxSpans > 0 && total >= q.cfg.MaxSpans {
+		q.hits.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("quota", "global"),
+			attribute.String("policy", string(q.cfg.Policy)),
+		))
+		if q.cfg.Policy == QuotaPolicyReject {
+			q.logger.Debug("Partial span rejected by the global quota", zap.String("service.name", pt.ServiceName))
+			return false, nil
+		}
+
+		if _, err := q.store.EvictTraces(ctx, "", int(total-q.cfg.MaxSpans+1), now); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,106 @@
+package otelpartialexporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/zap"
+)
+
+type fakeQuotaStore struct {
+	exists  bool
+	service int64
+	total   int64
+	evicted map[string]int
+}
+
+func (s *fakeQuotaStore) TraceExists(context.Context, string, string, string) (bool, error) {
+	return s.exists, nil
+}
+
+func (s *fakeQuotaStore) CountQuotaUsage(context.Context, string) (int64, int64, error) {
+	return s.service, s.total, nil
+}
+
+func (s *fakeQuotaStore) EvictTraces(_ context.Context, serviceName string, n int, _ time.Time) (int64, error) {
+	s.evicted[serviceName] += n
+	return int64(n), nil
+}
+
+func TestQuotaAdmit(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		cfg         QuotaConfig
+		store       fakeQuotaStore
+		wantAdmit   bool
+		wantEvicted map[string]int
+	}{
+		{
+			name:        "disabled",
+			cfg:         QuotaConfig{Policy: QuotaPolicyReject},
+			store:       fakeQuotaStore{service: 100, total: 100},
+			wantAdmit:   true,
+			wantEvicted: map[string]int{},
+		},
+		{
+			name:        "under quota",
+			cfg:         QuotaConfig{MaxSpansPerService: 10, MaxSpans: 100, Policy: QuotaPolicyReject},
+			store:       fakeQuotaStore{service: 9, total: 99},
+			wantAdmit:   true,
+			wantEvicted: map[string]int{},
+		},
+		{
+			name:        "existing span over quota",
+			cfg:         QuotaConfig{MaxSpansPerService: 10, Policy: QuotaPolicyReject},
+			store:       fakeQuotaStore{exists: true, service: 10, total: 10},
+			wantAdmit:   true,
+			wantEvicted: map[string]int{},
+		},
+		{
+			name:        "reject service quota",
+			cfg:         QuotaConfig{MaxSpansPerService: 10, Policy: QuotaPolicyReject},
+			store:       fakeQuotaStore{service: 10, total: 10},
+			wantAdmit:   false,
+			wantEvicted: map[string]int{},
+		},
+		{
+			name:        "reject global quota",
+			cfg:         QuotaConfig{MaxSpans: 100, Policy: QuotaPolicyReject},
+			store:       fakeQuotaStore{service: 1, total: 100},
+			wantAdmit:   false,
+			wantEvicted: map[string]int{},
+		},
+		{
+			name:        "evict service quota",
+			cfg:         QuotaConfig{MaxSpansPerService: 10, MaxSpans: 100, Policy: QuotaPolicyEvict},
+			store:       fakeQuotaStore{service: 10, total: 100},
+			wantAdmit:   true,
+			wantEvicted: map[string]int{"checkout": 1},
+		},
+		{
+			name:        "evict global quota",
+			cfg:         QuotaConfig{MaxSpans: 100, Policy: QuotaPolicyEvict},
+			store:       fakeQuotaStore{service: 1, total: 101},
+			wantAdmit:   true,
+			wantEvicted: map[string]int{"": 2},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.store.evicted = map[string]int{}
+			hits, err := noop.NewMeterProvider().Meter(meterName).Int64Counter("hits")
+			require.NoError(t, err)
+
+			q := &quota{cfg: tt.cfg, store: &tt.store, hits: hits, logger: zap.NewNop()}
+			admitted, err := q.admit(context.Background(), &postgres.PartialTrace{ServiceName: "checkout"}, time.Now())
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAdmit, admitted)
+			assert.Equal(t, tt.wantEvicted, tt.store.evicted)
+		})
+	}
+}
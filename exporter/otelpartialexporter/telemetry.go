@@ -0,0 +1,131 @@
+package otelpartialexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/G-Research/otel-partial-collector/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Reasons of the records dropped by the exporter.
+const (
+	dropReasonVersionNotAccepted = "version_not_accepted"
+	dropReasonUnknownEvent       = "unknown_event"
+	dropReasonUnknownBodyType    = "unknown_body_type"
+	dropReasonInvalidFrequency   = "invalid_frequency"
+	dropReasonUnmarshalFailure   = "unmarshal_failure"
+	// dropReasonTooLarge is recorded per span of a heartbeat over the maximum size
+	dropReasonTooLarge = "too_large"
+)
+
+// telemetry holds the instruments of the exporter internal telemetry.
+type telemetry struct {
+	processedRecords metric.Int64Counter
+	droppedRecords   metric.Int64Counter
+	dbWriteDuration  metric.Float64Histogram
+	batchSize        metric.Int64Histogram
+	payloadSize      metric.Int64Histogram
+	quotaHits        metric.Int64Counter
+	protocolRecords  metric.Int64Counter
+}
+
+func newTelemetry(meterProvider metric.MeterProvider) (*telemetry, error) {
+	meter := meterProvider.Meter(meterName)
+	var t telemetry
+	var errs []error
+	var err error
+
+	t.processedRecords, err = meter.Int64Counter(
+		"otelcol_otelpartialexporter_processed_records",
+		metric.WithDescription("Number of heartbeat and stop log records processed"),
+		metric.WithUnit("{record}"),
+	)
+	errs = append(errs, err)
+
+	t.droppedRecords, err = meter.Int64Counter(
+		"otelcol_otelpartialexporter_dropped_records",
+		metric.WithDescription("Number of log records dropped before they are processed"),
+		metric.WithUnit("{record}"),
+	)
+	errs = append(errs, err)
+
+	t.dbWriteDuration, err = meter.Float64Histogram(
+		"otelcol_otelpartialexporter_db_write_duration",
+		metric.WithDescription("Duration of the writes to the database"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5),
+	)
+	errs = append(errs, err)
+
+	t.batchSize, err = meter.Int64Histogram(
+		"otelcol_otelpartialexporter_batch_size",
+		metric.WithDescription("Number of log records in the batches received by the exporter"),
+		metric.WithUnit("{record}"),
+		metric.WithExplicitBucketBoundaries(1, 10, 50, 100, 500, 1000, 5000, 10000),
+	)
+	errs = append(errs, err)
+
+	t.payloadSize, err = meter.Int64Histogram(
+		"otelcol_otelpartialexporter_payload_size",
+		metric.WithDescription("Size of the partial spans written to the database"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(256, 1024, 4096, 16384, 65536, 262144, 1048576),
+	)
+	errs = append(errs, err)
+
+	t.quotaHits, err = meter.Int64Counter(
+		"otelcol_otelpartialexporter_quota_hits",
+		metric.WithDescription("Number of new partial spans over a quota"),
+		metric.WithUnit("{span}"),
+	)
+	errs = append(errs, err)
+
+	t.protocolRecords, err = meter.Int64Counter(
+		"otelcol_otelpartialexporter_protocol_records",
+		metric.WithDescription("Number of heartbeat and stop log records by protocol version"),
+		metric.WithUnit("{record}"),
+	)
+	errs = append(errs, err)
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("failed to create telemetry: %w", err)
+	}
+	return &t, nil
+}
+
+// dropReason maps the protocol decoding errors to the reasons of the dropped records.
+func dropReason(err error) string {
+	switch {
+	case errors.Is(err, protocol.ErrUnknownEvent):
+		return dropReasonUnknownEvent
+	case errors.Is(err, protocol.ErrUnknownBodyType):
+		return dropReasonUnknownBodyType
+	case errors.Is(err, protocol.ErrInvalidFrequency):
+		return dropReasonInvalidFrequency
+	default:
+		return dropReasonUnmarshalFailure
+	}
+}
+
+func (t *telemetry) recordDropped(ctx context.Context, reason string) {
+	t.droppedRecords.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", reason)))
+}
+
+func (t *telemetry) recordProcessed(ctx context.Context, event protocol.EventType) {
+	t.processedRecords.Add(ctx, 1, metric.WithAttributes(attribute.String("event", event.String())))
+}
+
+// timeDBWrite runs the database write, recording its duration for the operation.
+func (t *telemetry) timeDBWrite(ctx context.Context, operation string, write func() error) error {
+	start := time.Now()
+	err := write()
+	t.dbWriteDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("operation", operation),
+		attribute.Bool("error", err != nil),
+	))
+	return err
+}
@@ -0,0 +1,143 @@
+package otelpartialexporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"github.com/G-Research/otel-partial-collector/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collectMetrics returns the collected metrics by name.
+func collectMetrics(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	metrics := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+// sumByAttribute returns the values of the counter by the value of the attribute.
+func sumByAttribute(data metricdata.Aggregation, key attribute.Key) map[string]int64 {
+	values := map[string]int64{}
+	for _, dp := range data.(metricdata.Sum[int64]).DataPoints {
+		v, _ := dp.Attributes.Value(key)
+		values[v.Emit()] += dp.Value
+	}
+	return values
+}
+
+func TestTelemetry(t *testing.T) {
+	db := &fakeStore{traces: map[string]*postgres.PartialTrace{}}
+	reader := sdkmetric.NewManualReader()
+	e := newTestExporter(t, db, sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetTraceID([16]byte{1})
+	span.SetSpanID([8]byte{1})
+
+	logs := plog.NewLogs()
+	records := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	for _, msg := range []protocol.Message{
+		{Event: protocol.EventTypeHeartbeat, HeartbeatInterval: time.Second, Traces: traces},
+		{Event: protocol.EventTypeStop, Traces: traces},
+	} {
+		require.NoError(t, protocol.Encode(msg, records.AppendEmpty()))
+	}
+
+	unknownEvent := records.AppendEmpty()
+	require.NoError(t, protocol.Encode(protocol.Message{Event: protocol.EventTypeStop, Traces: traces}, unknownEvent))
+	unknownEvent.Attributes().PutStr(protocol.AttributeEvent, "start")
+
+	badFrequency := records.AppendEmpty()
+	require.NoError(t, protocol.Encode(protocol.Message{Event: protocol.EventTypeHeartbeat, Traces: traces}, badFrequency))
+	badFrequency.Attributes().PutStr(protocol.AttributeFrequency, "often")
+
+	badBodyType := records.AppendEmpty()
+	badBodyType.Attributes().PutStr(protocol.AttributeEvent, "stop")
+	badBodyType.Attributes().PutStr(protocol.AttributeBodyType, "avro")
+
+	unsupportedVersion := records.AppendEmpty()
+	unsupportedVersion.Attributes().PutInt(protocol.AttributeVersion, 3)
+
+	require.NoError(t, e.consumeLogs(context.Background(), logs))
+
+	// unmarshal failures only drop the record, the rest of the batch is processed
+	badBody := logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().AppendEmpty()
+	badBody.Attributes().PutStr(protocol.AttributeEvent, "stop")
+	badBody.Body().SetStr("not base64")
+	require.NoError(t, e.consumeLogs(context.Background(), logs))
+
+	metrics := collectMetrics(t, reader)
+	assert.Equal(t, map[string]int64{
+		"heartbeat": 2,
+		"stop":      2,
+	}, sumByAttribute(metrics["otelcol_otelpartialexporter_processed_records"], "event"))
+	assert.Equal(t, map[string]int64{
+		dropReasonVersionNotAccepted: 2,
+		dropReasonUnknownEvent:       2,
+		dropReasonInvalidFrequency:   2,
+		dropReasonUnknownBodyType:    2,
+		dropReasonUnmarshalFailure:   1,
+	}, sumByAttribute(metrics["otelcol_otelpartialexporter_dropped_records"], "reason"))
+
+	batchSize := metrics["otelcol_otelpartialexporter_batch_size"].(metricdata.Histogram[int64]).DataPoints[0]
+	assert.Equal(t, uint64(2), batchSize.Count)
+	assert.Equal(t, int64(6+7), batchSize.Sum)
+
+	payloadSize := metrics["otelcol_otelpartialexporter_payload_size"].(metricdata.Histogram[int64]).DataPoints[0]
+	assert.Equal(t, uint64(2), payloadSize.Count)
+	assert.Positive(t, payloadSize.Sum)
+
+	operations := map[string]uint64{}
+	for _, dp := range metrics["otelcol_otelpartialexporter_db_write_duration"].(metricdata.Histogram[float64]).DataPoints {
+		operation, _ := dp.Attributes.Value("operation")
+		operations[operation.AsString()] += dp.Count
+	}
+	assert.Equal(t, map[string]uint64{"put_trace": 2, "remove_trace": 2}, operations)
+}
+
+func TestTelemetryTooLarge(t *testing.T) {
+	db := &fakeStore{traces: map[string]*postgres.PartialTrace{}}
+	reader := sdkmetric.NewManualReader()
+	e := newTestExporter(t, db, sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	e.limits = LimitsConfig{MaxSpanSize: 10}
+
+	traces := ptrace.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	for i := range 2 {
+		span := spans.AppendEmpty()
+		span.SetTraceID([16]byte{1})
+		span.SetSpanID([8]byte{byte(i + 1)})
+		span.SetName("a span name longer than the maximum size")
+	}
+
+	logs := plog.NewLogs()
+	record := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	require.NoError(t, protocol.Encode(protocol.Message{Event: protocol.EventTypeHeartbeat, HeartbeatInterval: time.Second, Traces: traces}, record))
+	require.NoError(t, e.consumeLogs(context.Background(), logs))
+	assert.Empty(t, db.traces)
+
+	// each span of the heartbeat is counted
+	metrics := collectMetrics(t, reader)
+	assert.Equal(t, map[string]int64{
+		dropReasonTooLarge: 2,
+	}, sumByAttribute(metrics["otelcol_otelpartialexporter_dropped_records"], "reason"))
+}
@@ -0,0 +1,41 @@
+package otelpartialexporter
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// TenantConfig configures how the tenant owning a partial span is derived.
+// Partial spans of different tenants are stored apart, even when their ids collide.
+type TenantConfig struct {
+	// ResourceAttribute is the resource attribute holding the tenant.
+	ResourceAttribute string `mapstructure:"resource_attribute"`
+	// MetadataKey is the client metadata key holding the tenant, e.g. X-Scope-OrgID.
+	// It is used when the resource attribute is not set, and requires the receiver
+	// to include the metadata.
+	MetadataKey string `mapstructure:"metadata_key"`
+	// Default is the tenant of partial spans without a tenant.
+	Default string `mapstructure:"default"`
+}
+
+// tenant returns the tenant from the first resource attributes holding it,
+// falling back to the client metadata and the default.
+func (c *TenantConfig) tenant(ctx context.Context, resourceAttrs ...pcommon.Map) string {
+	if c.ResourceAttribute != "" {
+		for _, attrs := range resourceAttrs {
+			if v, ok := attrs.Get(c.ResourceAttribute); ok && v.AsString() != "" {
+				return v.AsString()
+			}
+		}
+	}
+
+	if c.MetadataKey != "" {
+		if values := client.FromContext(ctx).Metadata.Get(c.MetadataKey); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+
+	return c.Default
+}
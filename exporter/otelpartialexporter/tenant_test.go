@@ -0,0 +1,67 @@
+package otelpartialexporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+func TestTenant(t *testing.T) {
+	withTenant := pcommon.NewMap()
+	withTenant.PutStr("tenant", "from-resource")
+
+	ctxWithMetadata := client.NewContext(context.Background(), client.Info{
+		Metadata: client.NewMetadata(map[string][]string{"X-Scope-OrgID": {"from-metadata"}}),
+	})
+
+	cfg := TenantConfig{
+		ResourceAttribute: "tenant",
+		MetadataKey:       "X-Scope-OrgID",
+		Default:           "default",
+	}
+
+	for _, tt := range []struct {
+		name  string
+		cfg   TenantConfig
+		ctx   context.Context
+		attrs []pcommon.Map
+		want  string
+	}{
+		{
+			name:  "resource attribute",
+			cfg:   cfg,
+			ctx:   ctxWithMetadata,
+			attrs: []pcommon.Map{pcommon.NewMap(), withTenant},
+			want:  "from-resource",
+		},
+		{
+			name:  "metadata",
+			cfg:   cfg,
+			ctx:   ctxWithMetadata,
+			attrs: []pcommon.Map{pcommon.NewMap()},
+			want:  "from-metadata",
+		},
+		{
+			name:  "default",
+			cfg:   cfg,
+			ctx:   context.Background(),
+			attrs: []pcommon.Map{pcommon.NewMap()},
+			want:  "default",
+		},
+		{
+			name:  "not configured",
+			cfg:   TenantConfig{},
+			ctx:   ctxWithMetadata,
+			attrs: []pcommon.Map{withTenant},
+			want:  "",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.cfg.tenant(tt.ctx, tt.attrs...))
+		})
+	}
+}
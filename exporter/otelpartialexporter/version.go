@@ -0,0 +1,81 @@
+package otelpartialexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+
+	"github.com/G-Research/otel-partial-collector/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// ProtocolConfig selects the versions of the heartbeat protocol accepted by the exporter.
+type ProtocolConfig struct {
+	// AcceptedVersions are the accepted values of the partial.version attribute.
+	// Records of other versions are dropped.
+	AcceptedVersions []protocol.Version `mapstructure:"accepted_versions"`
+}
+
+func (c *ProtocolConfig) Validate() error {
+	if len(c.AcceptedVersions) == 0 {
+		return errors.New("at least one protocol version must be accepted")
+	}
+	for _, v := range c.AcceptedVersions {
+		if !v.Supported() {
+			return fmt.Errorf("unsupported protocol version: %d", v)
+		}
+	}
+	return nil
+}
+
+// versions filters the log records by protocol version, counting the records
+// of each version so old producers can be found before their version is dropped.
+type versions struct {
+	accepted map[protocol.Version]bool
+	records  metric.Int64Counter
+	logger   *zap.Logger
+}
+
+func newVersions(cfg ProtocolConfig, records metric.Int64Counter, logger *zap.Logger) *versions {
+	accepted := make(map[protocol.Version]bool, len(cfg.AcceptedVersions))
+	for _, v := range cfg.AcceptedVersions {
+		accepted[v] = true
+	}
+	return &versions{accepted: accepted, records: records, logger: logger}
+}
+
+// accept reports whether the version of the log record is accepted.
+func (v *versions) accept(ctx context.Context, record plog.LogRecord, resourceAttrs pcommon.Map) bool {
+	var serviceName string
+	if sn, ok := resourceAttrs.Get("service.name"); ok {
+		serviceName = sn.AsString()
+	}
+
+	version, err := protocol.VersionFromAttributes(record.Attributes())
+	versionAttr := "unsupported"
+	if err == nil {
+		versionAttr = version.String()
+	}
+	accepted := err == nil && v.accepted[version]
+
+	v.records.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("version", versionAttr),
+		attribute.Bool("accepted", accepted),
+		attribute.String("service.name", serviceName),
+	))
+
+	if !accepted {
+		v.logger.Warn(
+			"Dropped log record of a protocol version not accepted",
+			zap.String("version", versionAttr),
+			zap.String("service.name", serviceName),
+			zap.Error(err),
+		)
+	}
+	return accepted
+}
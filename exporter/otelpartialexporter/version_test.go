@@ -0,0 +1,70 @@
+package otelpartialexporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+
+	"github.com/G-Research/otel-partial-collector/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+)
+
+func TestProtocolConfigValidate(t *testing.T) {
+	assert.NoError(t, (&ProtocolConfig{AcceptedVersions: protocol.SupportedVersions}).Validate())
+	assert.ErrorContains(t, (&ProtocolConfig{}).Validate(), "at least one protocol version")
+	assert.ErrorContains(t, (&ProtocolConfig{AcceptedVersions: []protocol.Version{3}}).Validate(), "unsupported protocol version: 3")
+}
+
+func TestVersionsAccept(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	records, err := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter(meterName).Int64Counter("records")
+	require.NoError(t, err)
+	v := newVersions(ProtocolConfig{AcceptedVersions: []protocol.Version{protocol.Version2}}, records, zap.NewNop())
+
+	resourceAttrs := pcommon.NewMap()
+	resourceAttrs.PutStr("service.name", "checkout")
+	for _, tt := range []struct {
+		version  any
+		accepted bool
+	}{
+		{version: nil, accepted: false},
+		{version: int64(1), accepted: false},
+		{version: int64(2), accepted: true},
+		{version: "2", accepted: true},
+		{version: int64(3), accepted: false},
+	} {
+		record := plog.NewLogRecord()
+		if tt.version != nil {
+			require.NoError(t, record.Attributes().FromRaw(map[string]any{protocol.AttributeVersion: tt.version}))
+		}
+		assert.Equal(t, tt.accepted, v.accept(context.Background(), record, resourceAttrs), tt.version)
+	}
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	got := map[attribute.Distinct]int64{}
+	for _, dp := range rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64]).DataPoints {
+		got[dp.Attributes.Equivalent()] = dp.Value
+	}
+	want := func(version string, accepted bool) attribute.Distinct {
+		set := attribute.NewSet(
+			attribute.String("version", version),
+			attribute.Bool("accepted", accepted),
+			attribute.String("service.name", "checkout"),
+		)
+		return set.Equivalent()
+	}
+	assert.Equal(t, map[attribute.Distinct]int64{
+		want("1", false):           2,
+		want("2", true):            2,
+		want("unsupported", false): 1,
+	}, got)
+}
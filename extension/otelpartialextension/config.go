@@ -0,0 +1,46 @@
+package otelpartialextension
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+)
+
+// Config defines configuration for otelpartialextension.
+type Config struct {
+	confighttp.ServerConfig `mapstructure:",squash"`
+	// Postgres configures the connection to the postgres instance, as a URL or as structured settings.
+	Postgres postgres.Config `mapstructure:"postgres"`
+	// Shards are the postgres instances the partial spans are spread between
+	// instead of the single Postgres instance, as configured in the exporter and receiver.
+	Shards []postgres.ShardConfig `mapstructure:"shards"`
+	// Clock selects the clock the spans are expired with: "local" or "database", as configured
+	// in the exporter and receiver.
+	Clock partial.Clock `mapstructure:"clock"`
+}
+
+func createDefaultConfig() component.Config {
+	serverConfig := confighttp.NewDefaultServerConfig()
+	serverConfig.Endpoint = "localhost:13134"
+	return &Config{
+		ServerConfig: serverConfig,
+		Clock:        partial.ClockLocal,
+	}
+}
+
+func (c *Config) Validate() error {
+	if _, err := postgres.ResolveShards(c.Postgres, c.Shards); err != nil {
+		return err
+	}
+
+	// the API can remove partial spans, so it must not be exposed without authentication
+	if c.Auth == nil {
+		return errors.New("auth must be configured")
+	}
+
+	return nil
+}
@@ -0,0 +1,286 @@
+package otelpartialextension
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"go.uber.org/zap"
+)
+
+var (
+	tracesProtoUnmarshaler ptrace.ProtoUnmarshaler
+	tracesJSONMarshaler    ptrace.JSONMarshaler
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// store is the subset of the postgres.ShardedDB used by the API.
+type store interface {
+	ListTraces(ctx context.Context, filter postgres.TraceFilter) ([]*postgres.PartialTrace, error)
+	GetTrace(ctx context.Context, tenant, traceID, spanID string) (*postgres.PartialTrace, error)
+	ExpireTrace(ctx context.Context, tenant, traceID, spanID string, timestamp time.Time) error
+	RemoveTrace(ctx context.Context, tenant, traceID, spanID string) error
+	SetGCPaused(ctx context.Context, paused bool) error
+	IsGCPaused(ctx context.Context) (bool, error)
+}
+
+type partialSpan struct {
+	Tenant            string    `json:"tenant,omitempty"`
+	TraceID           string    `json:"trace_id"`
+	SpanID            string    `json:"span_id"`
+	ServiceName       string    `json:"service_name"`
+	SpanName          string    `json:"span_name"`
+	StartTime         time.Time `json:"start_time"`
+	LastHeartbeat     time.Time `json:"last_heartbeat"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	HeartbeatInterval string    `json:"heartbeat_interval"`
+	Forced            bool      `json:"forced"`
+	Evicted           bool      `json:"evicted"`
+	DeadLetterReason  string    `json:"dead_letter_reason,omitempty"`
+}
+
+type gcState struct {
+	Paused bool `json:"paused"`
+}
+
+type handler struct {
+	store  store
+	health *partial.HealthReporter
+	clock  partial.Clock
+	logger *zap.Logger
+}
+
+func newHandler(s store, health *partial.HealthReporter, clock partial.Clock, logger *zap.Logger) http.Handler {
+	h := &handler{
+		store:  s,
+		health: health,
+		clock:  clock,
+		logger: logger,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /spans", h.listSpans)
+	mux.HandleFunc("GET /spans/{trace_id}/{span_id}", h.getSpan)
+	mux.HandleFunc("DELETE /spans/{trace_id}/{span_id}", h.deleteSpan)
+	mux.HandleFunc("POST /spans/{trace_id}/{span_id}/expire", h.expireSpan)
+	mux.HandleFunc("GET /gc", h.getGCState)
+	mux.HandleFunc("POST /gc/pause", h.setGCPaused(true))
+	mux.HandleFunc("POST /gc/resume", h.setGCPaused(false))
+	return h.requireConnected(mux)
+}
+
+// requireConnected answers the requests with 503 until the database is first reached.
+func (h *handler) requireConnected(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.health.Connected() {
+			h.writeError(w, http.StatusServiceUnavailable, h.health.Err())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *handler) listSpans(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := postgres.TraceFilter{
+		Tenant:      query.Get("tenant"),
+		ServiceName: query.Get("service_name"),
+		SpanName:    query.Get("span_name"),
+		Limit:       defaultListLimit,
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxListLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	if v := query.Get("expired"); v != "" {
+		expired, err := strconv.ParseBool(v)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, errors.New("expired must be a boolean"))
+			return
+		}
+		if expired && h.clock == partial.ClockDatabase {
+			filter.Expired = true
+		} else if expired {
+			filter.ExpiredBefore = time.Now().UTC()
+		}
+	}
+
+	traces, err := h.store.ListTraces(r.Context(), filter)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	spans := make([]partialSpan, 0, len(traces))
+	for _, pt := range traces {
+		spans = append(spans, partialSpan{
+			Tenant:            pt.Tenant,
+			TraceID:           pt.TraceID,
+			SpanID:            pt.SpanID,
+			ServiceName:       pt.ServiceName,
+			SpanName:          pt.SpanName,
+			StartTime:         pt.StartTime,
+			LastHeartbeat:     pt.Timestamp,
+			ExpiresAt:         pt.ExpiresAt,
+			HeartbeatInterval: pt.HeartbeatInterval.String(),
+			Forced:            pt.Forced,
+			Evicted:           pt.Evicted,
+			DeadLetterReason:  pt.DeadLetterReason,
+		})
+	}
+
+	h.writeJSON(w, http.StatusOK, spans)
+}
+
+func (h *handler) getSpan(w http.ResponseWriter, r *http.Request) {
+	traceID, spanID, ok := h.spanIDs(w, r)
+	if !ok {
+		return
+	}
+
+	pt, err := h.store.GetTrace(r.Context(), tenant(r), traceID, spanID)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+
+	trace, err := tracesProtoUnmarshaler.UnmarshalTraces(pt.Trace)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to unmarshal traces: %w", err))
+		return
+	}
+
+	b, err := tracesJSONMarshaler.MarshalTraces(trace)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to marshal traces: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+func (h *handler) deleteSpan(w http.ResponseWriter, r *http.Request) {
+	traceID, spanID, ok := h.spanIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.RemoveTrace(r.Context(), tenant(r), traceID, spanID); err != nil {
+		h.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.logger.Info("Partial span deleted through the admin API", zap.String("tenant", tenant(r)), zap.String("trace_id", traceID), zap.String("span_id", spanID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) expireSpan(w http.ResponseWriter, r *http.Request) {
+	traceID, spanID, ok := h.spanIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.ExpireTrace(r.Context(), tenant(r), traceID, spanID, h.now()); err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+
+	h.logger.Info("Partial span expired through the admin API", zap.String("tenant", tenant(r)), zap.String("trace_id", traceID), zap.String("span_id", spanID))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *handler) getGCState(w http.ResponseWriter, r *http.Request) {
+	paused, err := h.store.IsGCPaused(r.Context())
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, gcState{Paused: paused})
+}
+
+func (h *handler) setGCPaused(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.store.SetGCPaused(r.Context(), paused); err != nil {
+			h.writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		h.logger.Info("GC state changed through the admin API", zap.Bool("paused", paused))
+		h.writeJSON(w, http.StatusOK, gcState{Paused: paused})
+	}
+}
+
+// now returns the time the spans are expired at, which is the zero time with the database
+// clock, so the database expires them at its own time.
+func (h *handler) now() time.Time {
+	if h.clock == partial.ClockDatabase {
+		return time.Time{}
+	}
+	return time.Now().UTC()
+}
+
+// spanIDs returns the trace and span id from the path, or writes the error response when they are invalid.
+func (h *handler) spanIDs(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	traceID, spanID := r.PathValue("trace_id"), r.PathValue("span_id")
+	if b, err := hex.DecodeString(traceID); err != nil || len(b) != 16 {
+		h.writeError(w, http.StatusBadRequest, errors.New("trace id must be 32 hex characters"))
+		return "", "", false
+	}
+	if b, err := hex.DecodeString(spanID); err != nil || len(b) != 8 {
+		h.writeError(w, http.StatusBadRequest, errors.New("span id must be 16 hex characters"))
+		return "", "", false
+	}
+	// the ids are stored in lowercase
+	return strings.ToLower(traceID), strings.ToLower(spanID), true
+}
+
+// tenant returns the tenant owning the span, given by the tenant query parameter.
+func tenant(r *http.Request) string {
+	return r.URL.Query().Get("tenant")
+}
+
+func (h *handler) writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, postgres.ErrTraceNotFound) {
+		h.writeError(w, http.StatusNotFound, err)
+		return
+	}
+	h.writeError(w, http.StatusInternalServerError, err)
+}
+
+func (h *handler) writeError(w http.ResponseWriter, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		h.logger.Error("Admin API request failed", zap.Error(err))
+	}
+	h.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (h *handler) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Warn("Failed to write response", zap.Error(err))
+	}
+}
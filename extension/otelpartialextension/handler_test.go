@@ -0,0 +1,234 @@
+package otelpartialextension
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"go.uber.org/zap"
+)
+
+const (
+	testTraceID = "0102030405060708090a0b0c0d0e0f10"
+	testSpanID  = "0102030405060708"
+)
+
+type fakeStore struct {
+	traces  map[string]*postgres.PartialTrace
+	filter  postgres.TraceFilter
+	expired []string
+	// expiredAt are the times the spans were expired at
+	expiredAt []time.Time
+	paused    bool
+}
+
+func (s *fakeStore) ListTraces(_ context.Context, filter postgres.TraceFilter) ([]*postgres.PartialTrace, error) {
+	s.filter = filter
+	var traces []*postgres.PartialTrace
+	for _, pt := range s.traces {
+		traces = append(traces, pt)
+	}
+	return traces, nil
+}
+
+func (s *fakeStore) GetTrace(_ context.Context, tenant, traceID, spanID string) (*postgres.PartialTrace, error) {
+	pt, ok := s.traces[tenant+traceID+spanID]
+	if !ok {
+		return nil, postgres.ErrTraceNotFound
+	}
+	return pt, nil
+}
+
+func (s *fakeStore) ExpireTrace(_ context.Context, tenant, traceID, spanID string, timestamp time.Time) error {
+	if _, ok := s.traces[tenant+traceID+spanID]; !ok {
+		return postgres.ErrTraceNotFound
+	}
+	s.expired = append(s.expired, tenant+traceID+spanID)
+	s.expiredAt = append(s.expiredAt, timestamp)
+	return nil
+}
+
+func (s *fakeStore) RemoveTrace(_ context.Context, tenant, traceID, spanID string) error {
+	delete(s.traces, tenant+traceID+spanID)
+	return nil
+}
+
+func (s *fakeStore) SetGCPaused(_ context.Context, paused bool) error {
+	s.paused = paused
+	return nil
+}
+
+func (s *fakeStore) IsGCPaused(context.Context) (bool, error) {
+	return s.paused, nil
+}
+
+func (s *fakeStore) Ping(context.Context) error {
+	return nil
+}
+
+// newTestHandler returns the handler of the store, connected without starting the extension.
+func newTestHandler(s *fakeStore, clock partial.Clock) http.Handler {
+	health := partial.NewHealthReporter(s, time.Hour)
+	health.Observe(nil)
+	return newHandler(s, health, clock, zap.NewNop())
+}
+
+func newTestStore(t *testing.T) *fakeStore {
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("process-order")
+	span.SetTraceID(pcommon.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+	span.SetSpanID(pcommon.SpanID{1, 2, 3, 4, 5, 6, 7, 8})
+
+	var m ptrace.ProtoMarshaler
+	b, err := m.MarshalTraces(traces)
+	require.NoError(t, err)
+
+	return &fakeStore{
+		traces: map[string]*postgres.PartialTrace{
+			testTraceID + testSpanID: {
+				TraceID:           testTraceID,
+				SpanID:            testSpanID,
+				Trace:             b,
+				ServiceName:       "checkout",
+				SpanName:          "process-order",
+				HeartbeatInterval: 5 * time.Second,
+			},
+		},
+	}
+}
+
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, http.NoBody))
+	return rec
+}
+
+func TestListSpans(t *testing.T) {
+	s := newTestStore(t)
+	h := newTestHandler(s, partial.ClockLocal)
+
+	rec := serve(h, http.MethodGet, "/spans?service_name=checkout&expired=true&limit=10")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "checkout", s.filter.ServiceName)
+	assert.Equal(t, 10, s.filter.Limit)
+	assert.False(t, s.filter.ExpiredBefore.IsZero())
+
+	var spans []partialSpan
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &spans))
+	require.Len(t, spans, 1)
+	assert.Equal(t, "process-order", spans[0].SpanName)
+	assert.Equal(t, "5s", spans[0].HeartbeatInterval)
+
+	rec = serve(h, http.MethodGet, "/spans?limit=0")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestGetSpan(t *testing.T) {
+	h := newTestHandler(newTestStore(t), partial.ClockLocal)
+
+	rec := serve(h, http.MethodGet, "/spans/"+testTraceID+"/"+testSpanID)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var u ptrace.JSONUnmarshaler
+	traces, err := u.UnmarshalTraces(rec.Body.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "process-order", traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Name())
+
+	rec = serve(h, http.MethodGet, "/spans/"+strings.ToUpper(testTraceID)+"/"+strings.ToUpper(testSpanID))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(h, http.MethodGet, "/spans/"+testTraceID+"/0807060504030201")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serve(h, http.MethodGet, "/spans/invalid/"+testSpanID)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestExpireAndDeleteSpan(t *testing.T) {
+	s := newTestStore(t)
+	h := newTestHandler(s, partial.ClockLocal)
+
+	rec := serve(h, http.MethodPost, "/spans/"+testTraceID+"/"+testSpanID+"/expire")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, []string{testTraceID + testSpanID}, s.expired)
+
+	rec = serve(h, http.MethodDelete, "/spans/"+testTraceID+"/"+testSpanID)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, s.traces)
+
+	rec = serve(h, http.MethodPost, "/spans/"+testTraceID+"/"+testSpanID+"/expire")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestDatabaseClock(t *testing.T) {
+	s := newTestStore(t)
+	h := newTestHandler(s, partial.ClockDatabase)
+
+	// the database compares and expires the spans with its own time
+	rec := serve(h, http.MethodGet, "/spans?expired=true")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, s.filter.Expired)
+	assert.True(t, s.filter.ExpiredBefore.IsZero())
+
+	rec = serve(h, http.MethodPost, "/spans/"+testTraceID+"/"+testSpanID+"/expire")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	require.Len(t, s.expiredAt, 1)
+	assert.True(t, s.expiredAt[0].IsZero())
+}
+
+func TestTenant(t *testing.T) {
+	s := newTestStore(t)
+	pt := *s.traces[testTraceID+testSpanID]
+	pt.Tenant = "team-a"
+	s.traces["team-a"+testTraceID+testSpanID] = &pt
+	h := newTestHandler(s, partial.ClockLocal)
+
+	rec := serve(h, http.MethodGet, "/spans?tenant=team-a")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "team-a", s.filter.Tenant)
+
+	rec = serve(h, http.MethodPost, "/spans/"+testTraceID+"/"+testSpanID+"/expire?tenant=team-a")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, []string{"team-a" + testTraceID + testSpanID}, s.expired)
+
+	rec = serve(h, http.MethodGet, "/spans/"+testTraceID+"/"+testSpanID+"?tenant=team-b")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestPauseResumeGC(t *testing.T) {
+	s := newTestStore(t)
+	h := newTestHandler(s, partial.ClockLocal)
+
+	rec := serve(h, http.MethodPost, "/gc/pause")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, s.paused)
+
+	rec = serve(h, http.MethodGet, "/gc")
+	assert.JSONEq(t, `{"paused":true}`, rec.Body.String())
+
+	rec = serve(h, http.MethodPost, "/gc/resume")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, s.paused)
+}
+
+func TestNotConnected(t *testing.T) {
+	s := newTestStore(t)
+	h := newHandler(s, partial.NewHealthReporter(s, time.Hour), partial.ClockLocal, zap.NewNop())
+
+	rec := serve(h, http.MethodGet, "/spans")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), partial.ErrNotConnected.Error())
+}
@@ -0,0 +1,107 @@
+package otelpartialextension
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/extension"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"go.uber.org/zap"
+)
+
+var typeStr = component.MustNewType("otelpartialextension")
+
+// otelPartialExtension exposes an HTTP API to inspect and manage the partial spans stored in the database.
+type otelPartialExtension struct {
+	cfg      *Config
+	db       *postgres.ShardedDB
+	settings component.TelemetrySettings
+	server   *http.Server
+	health   *partial.HealthReporter
+
+	logger *zap.Logger
+}
+
+// pingInterval is the interval of the pings reporting the status of the database.
+const pingInterval = 10 * time.Second
+
+func newPartialExtension(ctx context.Context, settings extension.Settings, baseCfg component.Config) (extension.Extension, error) {
+	cfg := baseCfg.(*Config)
+	shards, err := postgres.ResolveShards(cfg.Postgres, cfg.Shards)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := postgres.NewShardedDB(
+		ctx,
+		shards,
+		postgres.WithTracerProvider(settings.TracerProvider),
+		// the database is connected in the background after the start, see partial.HealthReporter
+		postgres.WithLazyConnect(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new db connection: %w", err)
+	}
+
+	return &otelPartialExtension{
+		cfg:      cfg,
+		db:       db,
+		settings: settings.TelemetrySettings,
+		health:   partial.NewHealthReporter(db, pingInterval),
+		logger:   settings.Logger,
+	}, nil
+}
+
+func (e *otelPartialExtension) Start(ctx context.Context, host component.Host) error {
+	listener, err := e.cfg.ToListener(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to bind to address %s: %w", e.cfg.Endpoint, err)
+	}
+
+	e.server, err = e.cfg.ToServer(ctx, host, e.settings, newHandler(e.db, e.health, e.cfg.Clock, e.logger))
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to create server: %w", err), listener.Close())
+	}
+
+	// the database is only connected once the extension is sure to start
+	e.health.Start(host)
+
+	e.logger.Info("Starting admin API", zap.String("endpoint", e.cfg.Endpoint))
+	go func() {
+		if err := e.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.logger.Error("Admin API server failed", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+func (e *otelPartialExtension) Shutdown(ctx context.Context) error {
+	e.logger.Info("Shutting down otel partial extension")
+	e.health.Shutdown()
+	var errs []error
+	if e.server != nil {
+		if err := e.server.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to shutdown server: %w", err))
+		}
+	}
+	if err := e.db.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func NewFactory() extension.Factory {
+	return extension.NewFactory(
+		typeStr,
+		createDefaultConfig,
+		newPartialExtension,
+		component.StabilityLevelAlpha,
+	)
+}
@@ -1,10 +1,11 @@
 #!/bin/bash
 
 main() {
-    for target in "exporter/otelpartialexporter" "receiver/otelpartialreceiver" "internal/postgres"; do
-        cd $target
-        golangci-lint run --config ../../.golangci.yaml
-        cd -
+    local root
+    root="$(git rev-parse --show-toplevel)"
+    for target in "exporter/otelpartialexporter" "receiver/otelpartialreceiver" "connector/otelpartialconnector" "extension/otelpartialextension" "internal/postgres" "internal/partial" "cmd/partialctl" "sdk/partialspanprocessor" "protocol"; do
+        cd "$root/$target"
+        golangci-lint run --config "$root/.golangci.yaml"
     done
 }
 
@@ -12,7 +12,7 @@ gotest() {
 main() {
     local failed=()
 
-    for target in "exporter/otelpartialexporter" "receiver/otelpartialreceiver" "internal/postgres"; do
+    for target in "exporter/otelpartialexporter" "receiver/otelpartialreceiver" "connector/otelpartialconnector" "extension/otelpartialextension" "internal/postgres" "internal/partial" "cmd/partialctl" "sdk/partialspanprocessor" "protocol"; do
         gotest "${target}" || failed+=("${target}")
     done
 
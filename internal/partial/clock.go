@@ -0,0 +1,23 @@
+package partial
+
+import "fmt"
+
+// Clock selects the clock the expiration times of the partial spans are computed and compared with.
+type Clock string
+
+const (
+	// ClockLocal uses the clock of each collector.
+	ClockLocal Clock = "local"
+	// ClockDatabase uses the clock of the database, so the skew between the collectors
+	// doesn't expire the partial spans early or late.
+	ClockDatabase Clock = "database"
+)
+
+func (c Clock) Validate() error {
+	switch c {
+	case ClockLocal, ClockDatabase:
+		return nil
+	default:
+		return fmt.Errorf("invalid clock: %q", c)
+	}
+}
@@ -0,0 +1,105 @@
+package partial
+
+import (
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// CompletionConfig defines the completion policy applied to garbage collected spans.
+type CompletionConfig struct {
+	// EndTime selects the end timestamp of the span. Valid values are
+	// "now", "last_heartbeat" and "last_heartbeat_plus_interval".
+	EndTime EndTimePolicy `mapstructure:"end_time"`
+	// ErrorStatus sets the span status to Error when enabled.
+	ErrorStatus bool `mapstructure:"error_status"`
+	// StatusMessage is the status message used when ErrorStatus is enabled.
+	StatusMessage string `mapstructure:"status_message"`
+}
+
+type EndTimePolicy string
+
+const (
+	EndTimeNow                       EndTimePolicy = "now"
+	EndTimeLastHeartbeat             EndTimePolicy = "last_heartbeat"
+	EndTimeLastHeartbeatPlusInterval EndTimePolicy = "last_heartbeat_plus_interval"
+)
+
+// DefaultCompletionConfig returns the completion policy that only ends the span at the time of the collection.
+func DefaultCompletionConfig() CompletionConfig {
+	return CompletionConfig{
+		EndTime:       EndTimeNow,
+		StatusMessage: "span abandoned: heartbeats stopped before the span ended",
+	}
+}
+
+func (c *CompletionConfig) Validate() error {
+	switch c.EndTime {
+	case EndTimeNow, EndTimeLastHeartbeat, EndTimeLastHeartbeatPlusInterval:
+		return nil
+	default:
+		return fmt.Errorf("invalid completion end time policy: %q", c.EndTime)
+	}
+}
+
+// GCReason describes why the span has been collected.
+type GCReason string
+
+const (
+	GCReasonExpired     GCReason = "expired"
+	GCReasonForced      GCReason = "forced"
+	GCReasonEvicted     GCReason = "evicted"
+	GCReasonMaxLifetime GCReason = "max_lifetime"
+)
+
+// Complete applies the completion policy to the collected span.
+func (c *CompletionConfig) Complete(span ptrace.Span, lastHeartbeat time.Time, interval time.Duration, reason GCReason, now time.Time) {
+	end := now
+	switch c.EndTime {
+	case EndTimeLastHeartbeat:
+		end = lastHeartbeat
+	case EndTimeLastHeartbeatPlusInterval:
+		end = lastHeartbeat.Add(interval)
+	}
+
+	endTimestamp := pcommon.NewTimestampFromTime(end)
+	// rows written before the heartbeat timestamp was known must not end before they started
+	if endTimestamp < span.StartTimestamp() {
+		endTimestamp = span.StartTimestamp()
+	}
+	span.SetEndTimestamp(endTimestamp)
+
+	if c.ErrorStatus {
+		span.Status().SetCode(ptrace.StatusCodeError)
+		span.Status().SetMessage(c.StatusMessage)
+	}
+
+	attrs := span.Attributes()
+	attrs.PutBool("partial.gc", true)
+	attrs.PutStr("partial.gc.reason", string(reason))
+}
+
+// MarkResurrected marks the collected span as resurrected, since it was already emitted for
+// the reason at emittedAt before it heartbeated again, and links it to that earlier emission.
+func MarkResurrected(span ptrace.Span, reason GCReason, emittedAt time.Time) {
+	span.Attributes().PutBool("partial.resurrected", true)
+
+	link := span.Links().AppendEmpty()
+	link.SetTraceID(span.TraceID())
+	link.SetSpanID(span.SpanID())
+	link.Attributes().PutStr("partial.gc.reason", string(reason))
+	link.Attributes().PutStr("partial.gc.time", emittedAt.UTC().Format(time.RFC3339Nano))
+}
+
+// MarkSnapshot marks the span as a snapshot of a live span, which is emitted again
+// later, and ends it provisionally at now.
+func MarkSnapshot(span ptrace.Span, now time.Time) {
+	end := pcommon.NewTimestampFromTime(now)
+	if end < span.StartTimestamp() {
+		end = span.StartTimestamp()
+	}
+	span.SetEndTimestamp(end)
+	span.Attributes().PutBool("partial.snapshot", true)
+}
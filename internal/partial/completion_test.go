@@ -0,0 +1,125 @@
+package partial
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestComplete(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	start := now.Add(-time.Hour)
+	lastHeartbeat := now.Add(-time.Minute)
+	interval := 10 * time.Second
+
+	tests := []struct {
+		name     string
+		cfg      CompletionConfig
+		start    time.Time
+		wantEnd  time.Time
+		wantCode ptrace.StatusCode
+		wantMsg  string
+	}{
+		{
+			name:     "now",
+			cfg:      CompletionConfig{EndTime: EndTimeNow},
+			start:    start,
+			wantEnd:  now,
+			wantCode: ptrace.StatusCodeUnset,
+		},
+		{
+			name:     "last heartbeat",
+			cfg:      CompletionConfig{EndTime: EndTimeLastHeartbeat},
+			start:    start,
+			wantEnd:  lastHeartbeat,
+			wantCode: ptrace.StatusCodeUnset,
+		},
+		{
+			name:     "last heartbeat plus interval",
+			cfg:      CompletionConfig{EndTime: EndTimeLastHeartbeatPlusInterval},
+			start:    start,
+			wantEnd:  lastHeartbeat.Add(interval),
+			wantCode: ptrace.StatusCodeUnset,
+		},
+		{
+			name:     "end is never before start",
+			cfg:      CompletionConfig{EndTime: EndTimeLastHeartbeat},
+			start:    now,
+			wantEnd:  now,
+			wantCode: ptrace.StatusCodeUnset,
+		},
+		{
+			name:     "error status",
+			cfg:      CompletionConfig{EndTime: EndTimeNow, ErrorStatus: true, StatusMessage: "abandoned"},
+			start:    start,
+			wantEnd:  now,
+			wantCode: ptrace.StatusCodeError,
+			wantMsg:  "abandoned",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := ptrace.NewSpan()
+			span.SetStartTimestamp(pcommon.NewTimestampFromTime(tt.start))
+
+			tt.cfg.Complete(span, lastHeartbeat, interval, GCReasonExpired, now)
+
+			assert.Equal(t, pcommon.NewTimestampFromTime(tt.wantEnd), span.EndTimestamp())
+			assert.Equal(t, tt.wantCode, span.Status().Code())
+			assert.Equal(t, tt.wantMsg, span.Status().Message())
+
+			gc, ok := span.Attributes().Get("partial.gc")
+			assert.True(t, ok)
+			assert.True(t, gc.Bool())
+
+			reason, ok := span.Attributes().Get("partial.gc.reason")
+			assert.True(t, ok)
+			assert.Equal(t, "expired", reason.Str())
+		})
+	}
+}
+
+func TestMarkResurrected(t *testing.T) {
+	emittedAt := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	span := ptrace.NewSpan()
+	span.SetTraceID(pcommon.TraceID{1, 2, 3})
+	span.SetSpanID(pcommon.SpanID{4, 5, 6})
+
+	MarkResurrected(span, GCReasonExpired, emittedAt)
+
+	resurrected, ok := span.Attributes().Get("partial.resurrected")
+	assert.True(t, ok)
+	assert.True(t, resurrected.Bool())
+
+	// the link points at the earlier emission of the same span
+	assert.Equal(t, 1, span.Links().Len())
+	link := span.Links().At(0)
+	assert.Equal(t, span.TraceID(), link.TraceID())
+	assert.Equal(t, span.SpanID(), link.SpanID())
+	assert.Equal(t, map[string]any{
+		"partial.gc.reason": "expired",
+		"partial.gc.time":   emittedAt.Format(time.RFC3339Nano),
+	}, link.Attributes().AsRaw())
+}
+
+func TestMarkSnapshot(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	span := ptrace.NewSpan()
+	span.SetStartTimestamp(pcommon.NewTimestampFromTime(now.Add(-6 * time.Hour)))
+
+	MarkSnapshot(span, now)
+
+	assert.Equal(t, pcommon.NewTimestampFromTime(now), span.EndTimestamp())
+	assert.Equal(t, ptrace.StatusCodeUnset, span.Status().Code())
+	assert.Equal(t, map[string]any{"partial.snapshot": true}, span.Attributes().AsRaw())
+
+	// a span started after now by the clock of the collector must not end before it started
+	span.SetStartTimestamp(pcommon.NewTimestampFromTime(now.Add(time.Second)))
+	MarkSnapshot(span, now)
+	assert.Equal(t, span.StartTimestamp(), span.EndTimestamp())
+}
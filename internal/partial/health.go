@@ -0,0 +1,176 @@
+package partial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componentstatus"
+)
+
+// ErrNotConnected is returned by the operations of a component until its database is first reached.
+var ErrNotConnected = errors.New("database not connected yet")
+
+// Pinger checks the connectivity to the database.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthReporter reports the status of a component from the connectivity to its
+// database: a recoverable error when a ping or an operation fails, and ok again
+// once a ping or an operation succeeds. Only the changes of status are reported,
+// except before the database is first reached, when every failed attempt is.
+type HealthReporter struct {
+	pinger   Pinger
+	interval time.Duration
+
+	mu        sync.Mutex
+	hosts     []component.Host
+	err       error
+	connected bool
+
+	startOnce sync.Once
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewHealthReporter returns a reporter pinging the database at the interval.
+func NewHealthReporter(pinger Pinger, interval time.Duration) *HealthReporter {
+	return &HealthReporter{
+		pinger:   pinger,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start reports the status to the host and starts connecting to the database,
+// retrying with a backoff until it is reached, then pinging it at the interval.
+// A component shared by several pipelines starts the reporter with the host of
+// each of them.
+func (h *HealthReporter) Start(host component.Host) {
+	h.mu.Lock()
+	h.hosts = append(h.hosts, host)
+	h.mu.Unlock()
+
+	h.startOnce.Do(func() {
+		h.wg.Add(1)
+		go h.loop()
+	})
+}
+
+// Shutdown stops pinging the database.
+func (h *HealthReporter) Shutdown() {
+	select {
+	case <-h.stopCh:
+	default:
+		close(h.stopCh)
+	}
+	h.wg.Wait()
+}
+
+func (h *HealthReporter) loop() {
+	defer h.wg.Done()
+
+	if !h.connect() {
+		return
+	}
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stopCh:
+			return
+		case <-ticker.C:
+			h.Observe(h.ping())
+		}
+	}
+}
+
+// connect pings the database until it is reached, or an operation succeeds, doubling
+// the wait between the attempts up to the interval. It returns false if the reporter
+// is shut down first.
+func (h *HealthReporter) connect() bool {
+	backoff := min(time.Second, h.interval)
+	for {
+		if h.Connected() {
+			return true
+		}
+		err := h.ping()
+		if err == nil {
+			h.Observe(nil)
+			return true
+		}
+		h.report(fmt.Errorf("%w: %w", ErrNotConnected, err))
+
+		select {
+		case <-h.stopCh:
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, h.interval)
+	}
+}
+
+func (h *HealthReporter) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.interval)
+	defer cancel()
+	return h.pinger.Ping(ctx)
+}
+
+// Observe records the outcome of a database operation. Cancellations are ignored,
+// as they come from the shutdown of the component rather than from the database.
+func (h *HealthReporter) Observe(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		h.connected = true
+	}
+	if (err == nil) == (h.err == nil) {
+		return
+	}
+	h.reportLocked(err)
+}
+
+// report reports the error, even if an error is already reported.
+func (h *HealthReporter) report(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reportLocked(err)
+}
+
+func (h *HealthReporter) reportLocked(err error) {
+	h.err = err
+	ev := componentstatus.NewEvent(componentstatus.StatusOK)
+	if err != nil {
+		ev = componentstatus.NewRecoverableErrorEvent(err)
+	}
+	for _, host := range h.hosts {
+		componentstatus.ReportStatus(host, ev)
+	}
+}
+
+// Connected returns whether the database has been reached since the start.
+func (h *HealthReporter) Connected() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.connected
+}
+
+// Err returns the error of the last failed ping or operation, or nil if the
+// database is reachable. It wraps ErrNotConnected until the database is first reached.
+func (h *HealthReporter) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err == nil && !h.connected {
+		return ErrNotConnected
+	}
+	return h.err
+}
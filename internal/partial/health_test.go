@@ -0,0 +1,103 @@
+package partial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componentstatus"
+	"go.opentelemetry.io/collector/component/componenttest"
+)
+
+// statusHost records the statuses reported by the component.
+type statusHost struct {
+	component.Host
+	mu       sync.Mutex
+	statuses []componentstatus.Status
+}
+
+func (h *statusHost) Report(ev *componentstatus.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.statuses = append(h.statuses, ev.Status())
+}
+
+func (h *statusHost) reported() []componentstatus.Status {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]componentstatus.Status(nil), h.statuses...)
+}
+
+type fakePinger struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (p *fakePinger) Ping(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *fakePinger) setErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+func TestHealthReporterObserve(t *testing.T) {
+	h := NewHealthReporter(&fakePinger{}, time.Hour)
+	first := &statusHost{Host: componenttest.NewNopHost()}
+	second := &statusHost{Host: componenttest.NewNopHost()}
+	h.Start(first)
+	h.Start(second)
+	defer h.Shutdown()
+	assert.Eventually(t, h.Connected, time.Second, time.Millisecond)
+
+	h.Observe(nil)
+	h.Observe(errors.New("connection refused"))
+	h.Observe(errors.New("connection refused"))
+	h.Observe(fmt.Errorf("shutting down: %w", context.Canceled))
+	assert.EqualError(t, h.Err(), "connection refused")
+	h.Observe(nil)
+	h.Observe(nil)
+	assert.NoError(t, h.Err())
+
+	want := []componentstatus.Status{componentstatus.StatusRecoverableError, componentstatus.StatusOK}
+	assert.Equal(t, want, first.reported())
+	assert.Equal(t, want, second.reported())
+}
+
+func TestHealthReporterPing(t *testing.T) {
+	pinger := &fakePinger{err: errors.New("connection refused")}
+	h := NewHealthReporter(pinger, time.Millisecond)
+	host := &statusHost{Host: componenttest.NewNopHost()}
+	h.Start(host)
+	defer h.Shutdown()
+
+	assert.ErrorIs(t, h.Err(), ErrNotConnected)
+	// every failed attempt to connect is reported
+	assert.Eventually(t, func() bool {
+		return len(host.reported()) > 2
+	}, time.Second, time.Millisecond)
+	assert.False(t, h.Connected())
+
+	pinger.setErr(nil)
+	assert.Eventually(t, h.Connected, time.Second, time.Millisecond)
+	assert.NoError(t, h.Err())
+	statuses := host.reported()
+	assert.Equal(t, componentstatus.StatusOK, statuses[len(statuses)-1])
+
+	pinger.setErr(errors.New("connection refused"))
+	assert.Eventually(t, func() bool {
+		return h.Err() != nil
+	}, time.Second, time.Millisecond)
+	assert.NotErrorIs(t, h.Err(), ErrNotConnected)
+	assert.True(t, h.Connected())
+}
@@ -0,0 +1,91 @@
+package partial
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// FlattenTraces splits the traces into traces containing a single span each.
+func FlattenTraces(traces ptrace.Traces) []ptrace.Traces {
+	spanCount := traces.SpanCount()
+	if spanCount == 1 {
+		return []ptrace.Traces{traces}
+	}
+
+	newTraces := make([]ptrace.Traces, 0, spanCount)
+	resourceSpans := traces.ResourceSpans()
+	for i := range resourceSpans.Len() {
+		resourceSpan := resourceSpans.At(i)
+		resource := resourceSpan.Resource()
+		scopeSpans := resourceSpan.ScopeSpans()
+		for j := range scopeSpans.Len() {
+			scopeSpan := scopeSpans.At(j)
+			scope := scopeSpan.Scope()
+			spans := scopeSpan.Spans()
+			for k := range spans.Len() {
+				span := spans.At(k)
+
+				newTrace := ptrace.NewTraces()
+				newResourceSpans := newTrace.ResourceSpans()
+				newResourceSpan := newResourceSpans.AppendEmpty()
+				newResourceSpan.SetSchemaUrl(resourceSpan.SchemaUrl())
+				newResource := newResourceSpan.Resource()
+				resource.CopyTo(newResource)
+				newScopeSpans := newResourceSpan.ScopeSpans()
+				newScopeSpan := newScopeSpans.AppendEmpty()
+				newScopeSpan.SetSchemaUrl(scopeSpan.SchemaUrl())
+				newScope := newScopeSpan.Scope()
+				scope.CopyTo(newScope)
+				newSpans := newScopeSpan.Spans()
+				newSpan := newSpans.AppendEmpty()
+				span.CopyTo(newSpan)
+
+				newTraces = append(newTraces, newTrace)
+			}
+		}
+	}
+
+	return newTraces
+}
+
+// MergeAttributes copies the attributes from the sources into dst, excluding the
+// ones with the "partial." prefix. Attributes already present in dst take precedence.
+func MergeAttributes(dst pcommon.Map, sources ...pcommon.Map) {
+	for _, src := range sources {
+		src.Range(func(k string, v pcommon.Value) bool {
+			if strings.HasPrefix(k, "partial.") {
+				return true
+			}
+
+			_, ok := dst.Get(k)
+			if ok {
+				return true
+			}
+
+			switch v.Type() {
+			case pcommon.ValueTypeBool:
+				dst.PutBool(k, v.Bool())
+			case pcommon.ValueTypeBytes:
+				bytes := dst.PutEmptyBytes(k)
+				v.Bytes().MoveTo(bytes)
+			case pcommon.ValueTypeDouble:
+				dst.PutDouble(k, v.Double())
+			case pcommon.ValueTypeInt:
+				dst.PutInt(k, v.Int())
+			case pcommon.ValueTypeMap:
+				m := dst.PutEmptyMap(k)
+				v.Map().MoveTo(m)
+			case pcommon.ValueTypeStr:
+				dst.PutStr(k, v.Str())
+			case pcommon.ValueTypeEmpty:
+				dst.PutEmpty(k)
+			case pcommon.ValueTypeSlice:
+				s := dst.PutEmptySlice(k)
+				v.Slice().MoveAndAppendTo(s)
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package postgres
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/config/configtls"
+)
+
+const defaultPort = "5432"
+
+// queryExecModes are the accepted values of Config.QueryExecMode.
+var queryExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// Config configures the connection to a postgres instance, either as a URL or as
+// structured settings. A string is unmarshaled as the URL, so a postgres URL can
+// be configured in place of the structured settings.
+type Config struct {
+	// URL is the connection string, as a URL or as keyword/value pairs. It cannot
+	// be configured with Hosts, Database or User.
+	URL string `mapstructure:"url"`
+	// Hosts are the hosts of the instance as host or host:port, tried in order.
+	Hosts []string `mapstructure:"hosts"`
+	// Database is the name of the database.
+	Database string `mapstructure:"database"`
+	// User is the user connecting to the database.
+	User string `mapstructure:"user"`
+	// Password is the password of the user. Use ${env:VAR} to read it from an environment variable.
+	Password configopaque.String `mapstructure:"password"`
+	// PasswordFile is the path of a file holding the password of the user.
+	PasswordFile string `mapstructure:"password_file"`
+	// TLS configures the TLS connection to the database. If unset, the sslmode of the URL
+	// applies, which defaults to trying TLS without verifying the certificates.
+	TLS *configtls.ClientConfig `mapstructure:"tls"`
+	// MaxConns is the maximum number of connections of the pool.
+	MaxConns int32 `mapstructure:"max_conns"`
+	// MinConns is the number of connections the pool keeps open.
+	MinConns int32 `mapstructure:"min_conns"`
+	// ConnectTimeout limits the time to establish a connection.
+	ConnectTimeout string `mapstructure:"connect_timeout"`
+	// StatementTimeout limits the time of each statement on the server.
+	StatementTimeout string `mapstructure:"statement_timeout"`
+	// QueryExecMode selects how the queries are sent: cache_statement, cache_describe,
+	// describe_exec, exec or simple_protocol. Use exec or simple_protocol behind PgBouncer
+	// in transaction pooling mode, which does not support the prepared statements.
+	QueryExecMode string `mapstructure:"query_exec_mode"`
+}
+
+// UnmarshalText unmarshals a postgres URL.
+func (c *Config) UnmarshalText(text []byte) error {
+	*c = Config{URL: string(text)}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	if c.URL != "" {
+		if len(c.Hosts) > 0 || c.Database != "" || c.User != "" {
+			return errors.New("url cannot be configured with hosts, database or user")
+		}
+		if _, err := pgx.ParseConfig(c.URL); err != nil {
+			return fmt.Errorf("invalid postgres config: %w", err)
+		}
+	}
+
+	for _, host := range c.Hosts {
+		if host == "" {
+			return errors.New("host cannot be empty")
+		}
+	}
+
+	if c.Password != "" && c.PasswordFile != "" {
+		return errors.New("password and password_file cannot be both configured")
+	}
+
+	if c.MaxConns < 0 || c.MinConns < 0 {
+		return errors.New("max_conns and min_conns cannot be negative")
+	}
+	if c.MaxConns > 0 && c.MinConns > c.MaxConns {
+		return errors.New("min_conns cannot be greater than max_conns")
+	}
+
+	if _, err := parseTimeout(c.ConnectTimeout); err != nil {
+		return fmt.Errorf("invalid connect_timeout: %w", err)
+	}
+	if _, err := parseTimeout(c.StatementTimeout); err != nil {
+		return fmt.Errorf("invalid statement_timeout: %w", err)
+	}
+
+	if _, ok := queryExecModes[c.QueryExecMode]; c.QueryExecMode != "" && !ok {
+		return fmt.Errorf("invalid query_exec_mode %q", c.QueryExecMode)
+	}
+
+	return nil
+}
+
+// empty returns whether nothing is configured.
+func (c Config) empty() bool {
+	return reflect.DeepEqual(c, Config{})
+}
+
+// poolConfig returns the configuration of the pgx pool, reading the password
+// file and the TLS files.
+func (c Config) poolConfig(ctx context.Context) (*pgxpool.Config, error) {
+	conn := c.URL
+	if conn == "" {
+		conn = c.connString()
+	}
+	cfg, err := pgxpool.ParseConfig(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse postgres config: %w", err)
+	}
+
+	if c.Password != "" {
+		cfg.ConnConfig.Password = string(c.Password)
+	}
+	if c.PasswordFile != "" {
+		b, err := os.ReadFile(c.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password file: %w", err)
+		}
+		cfg.ConnConfig.Password = strings.TrimSpace(string(b))
+	}
+
+	if c.TLS != nil {
+		tlsCfg, err := c.TLS.LoadTLSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		setTLSConfig(cfg.ConnConfig, tlsCfg)
+	}
+
+	if c.MaxConns > 0 {
+		cfg.MaxConns = c.MaxConns
+	}
+	if c.MinConns > 0 {
+		cfg.MinConns = c.MinConns
+	}
+
+	// the timeouts are validated
+	if d, _ := parseTimeout(c.ConnectTimeout); d > 0 {
+		cfg.ConnConfig.ConnectTimeout = d
+	}
+	if d, _ := parseTimeout(c.StatementTimeout); d > 0 {
+		cfg.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(d.Milliseconds(), 10)
+	}
+
+	if mode, ok := queryExecModes[c.QueryExecMode]; ok {
+		cfg.ConnConfig.DefaultQueryExecMode = mode
+	}
+
+	return cfg, nil
+}
+
+// connString returns the keyword/value connection string of the structured settings.
+func (c Config) connString() string {
+	var params []string
+	if len(c.Hosts) > 0 {
+		hosts := make([]string, 0, len(c.Hosts))
+		ports := make([]string, 0, len(c.Hosts))
+		for _, h := range c.Hosts {
+			host, port, err := net.SplitHostPort(h)
+			if err != nil {
+				host, port = h, defaultPort
+			}
+			hosts = append(hosts, host)
+			ports = append(ports, port)
+		}
+		params = append(params, "host="+quote(strings.Join(hosts, ",")), "port="+quote(strings.Join(ports, ",")))
+	}
+	if c.Database != "" {
+		params = append(params, "dbname="+quote(c.Database))
+	}
+	if c.User != "" {
+		params = append(params, "user="+quote(c.User))
+	}
+	return strings.Join(params, " ")
+}
+
+// setTLSConfig replaces the TLS configuration derived from the sslmode for every
+// host, verifying each host against its own name. A nil configuration disables TLS.
+func setTLSConfig(cfg *pgx.ConnConfig, tlsCfg *tls.Config) {
+	// the sslmode adds a fallback without TLS, or with TLS, for every host
+	type address struct {
+		host string
+		port uint16
+	}
+	seen := map[address]bool{{cfg.Host, cfg.Port}: true}
+	var fallbacks []*pgconn.FallbackConfig
+	for _, fallback := range cfg.Fallbacks {
+		addr := address{fallback.Host, fallback.Port}
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		fallbacks = append(fallbacks, &pgconn.FallbackConfig{Host: fallback.Host, Port: fallback.Port})
+	}
+
+	cfg.TLSConfig = hostTLSConfig(tlsCfg, cfg.Host)
+	for _, fallback := range fallbacks {
+		fallback.TLSConfig = hostTLSConfig(tlsCfg, fallback.Host)
+	}
+	cfg.Fallbacks = fallbacks
+}
+
+func hostTLSConfig(tlsCfg *tls.Config, host string) *tls.Config {
+	if tlsCfg == nil {
+		return nil
+	}
+	tlsCfg = tlsCfg.Clone()
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName = host
+	}
+	return tlsCfg
+}
+
+// parseTimeout parses an optional non-negative duration.
+func parseTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("cannot be negative")
+	}
+	return d, nil
+}
+
+// quote quotes a value of a keyword/value connection string.
+func quote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetGCPaused pauses or resumes the gc of all receivers using the database.
+func (db *DB) SetGCPaused(ctx context.Context, paused bool) error {
+	q := `
+UPDATE gc_state
+SET paused = $1, updated_at = now()
+	`
+
+	if _, err := db.Exec(ctx, q, paused); err != nil {
+		return fmt.Errorf("failed to update gc state: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) IsGCPaused(ctx context.Context) (bool, error) {
+	q := `
+SELECT paused FROM gc_state
+	`
+
+	var paused bool
+	if err := db.QueryRow(ctx, q).Scan(&paused); err != nil {
+		return false, fmt.Errorf("failed to get gc state: %w", err)
+	}
+
+	return paused, nil
+}
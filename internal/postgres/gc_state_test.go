@@ -0,0 +1,31 @@
+package postgres_test
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/require"
+	"gotest.tools/v3/assert"
+)
+
+func (ts *TestSuite) TestGCPaused() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		err := db.SetGCPaused(context.Background(), false)
+		t.Logf("failed to resume gc: %v", err)
+		ts.releaseDB()
+	})
+
+	paused, err := db.IsGCPaused(ctx)
+	require.NoError(t, err)
+	assert.Assert(t, !paused)
+
+	err = db.SetGCPaused(ctx, true)
+	require.NoError(t, err)
+
+	paused, err = db.IsGCPaused(ctx)
+	require.NoError(t, err)
+	assert.Assert(t, paused)
+}
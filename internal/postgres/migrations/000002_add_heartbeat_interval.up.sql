@@ -0,0 +1,2 @@
+ALTER TABLE partial_traces
+    ADD COLUMN heartbeat_interval interval DEFAULT '0' NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE partial_traces
+    ADD COLUMN service_name text DEFAULT '' NOT NULL,
+    ADD COLUMN span_name text DEFAULT '' NOT NULL,
+    ADD COLUMN start_time timestamp with time zone;
@@ -0,0 +1,14 @@
+ALTER TABLE partial_traces
+    ADD COLUMN forced boolean DEFAULT false NOT NULL;
+
+CREATE TABLE gc_state (
+    id boolean DEFAULT true NOT NULL,
+    paused boolean DEFAULT false NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT gc_state_single_row CHECK (id)
+);
+
+ALTER TABLE ONLY gc_state
+    ADD CONSTRAINT gc_state_pkey PRIMARY KEY (id);
+
+INSERT INTO gc_state DEFAULT VALUES;
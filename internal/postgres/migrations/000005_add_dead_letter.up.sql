@@ -0,0 +1,3 @@
+ALTER TABLE partial_traces
+    ADD COLUMN dead_lettered_at timestamp with time zone,
+    ADD COLUMN dead_letter_reason text;
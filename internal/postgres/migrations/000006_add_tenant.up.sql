@@ -0,0 +1,8 @@
+ALTER TABLE partial_traces
+    ADD COLUMN tenant text DEFAULT '' NOT NULL;
+
+ALTER TABLE ONLY partial_traces
+    DROP CONSTRAINT partial_traces_pkey;
+
+ALTER TABLE ONLY partial_traces
+    ADD CONSTRAINT partial_traces_pkey PRIMARY KEY (tenant, span_id, trace_id);
@@ -0,0 +1,4 @@
+ALTER TABLE partial_traces
+    ADD COLUMN evicted boolean DEFAULT false NOT NULL;
+
+CREATE INDEX idx_partial_traces_service_name ON partial_traces USING btree (service_name);
@@ -0,0 +1,16 @@
+ALTER TABLE partial_traces
+    ADD COLUMN lifetime_expires_at timestamp with time zone;
+
+CREATE TABLE partial_trace_tombstones (
+    tenant text DEFAULT '' NOT NULL,
+    trace_id text NOT NULL,
+    span_id text NOT NULL,
+    reason text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    expires_at timestamp with time zone NOT NULL
+);
+
+ALTER TABLE ONLY partial_trace_tombstones
+    ADD CONSTRAINT partial_trace_tombstones_pkey PRIMARY KEY (tenant, span_id, trace_id);
+
+CREATE INDEX idx_partial_trace_tombstones_expires_at ON partial_trace_tombstones USING btree (expires_at);
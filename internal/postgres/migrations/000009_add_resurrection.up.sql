@@ -0,0 +1,3 @@
+ALTER TABLE partial_traces
+    ADD COLUMN previous_gc_reason text,
+    ADD COLUMN previous_gc_at timestamp with time zone;
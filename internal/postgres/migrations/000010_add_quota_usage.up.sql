@@ -0,0 +1,42 @@
+-- The quota usage is kept per service by triggers in the transaction changing the
+-- partial spans, so the exporter doesn't count the partial spans for every new span.
+BEGIN;
+
+LOCK TABLE partial_traces IN SHARE ROW EXCLUSIVE MODE;
+
+CREATE TABLE partial_trace_quota_usage (
+    service_name text PRIMARY KEY,
+    count bigint NOT NULL
+);
+
+INSERT INTO partial_trace_quota_usage (service_name, count)
+SELECT service_name, COUNT(*) FROM partial_traces WHERE NOT evicted GROUP BY service_name;
+
+CREATE FUNCTION update_partial_trace_quota_usage() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        IF NOT OLD.evicted THEN
+            UPDATE partial_trace_quota_usage SET count = count - 1 WHERE service_name = OLD.service_name;
+        END IF;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        IF NOT NEW.evicted THEN
+            INSERT INTO partial_trace_quota_usage (service_name, count) VALUES (NEW.service_name, 1)
+            ON CONFLICT (service_name) DO UPDATE SET count = partial_trace_quota_usage.count + 1;
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER partial_traces_quota_usage_insert_delete
+    AFTER INSERT OR DELETE ON partial_traces
+    FOR EACH ROW EXECUTE FUNCTION update_partial_trace_quota_usage();
+
+CREATE TRIGGER partial_traces_quota_usage_update
+    AFTER UPDATE OF evicted, service_name ON partial_traces
+    FOR EACH ROW
+    WHEN (OLD.evicted IS DISTINCT FROM NEW.evicted OR OLD.service_name IS DISTINCT FROM NEW.service_name)
+    EXECUTE FUNCTION update_partial_trace_quota_usage();
+
+COMMIT;
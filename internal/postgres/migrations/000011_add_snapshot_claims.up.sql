@@ -0,0 +1,13 @@
+-- The snapshot claims are kept apart from the partial spans, so claiming the spans
+-- doesn't conflict with the gc transactions reading them.
+CREATE TABLE partial_trace_snapshots (
+    tenant text DEFAULT '' NOT NULL,
+    trace_id text NOT NULL,
+    span_id text NOT NULL,
+    last_snapshot_at timestamp with time zone NOT NULL
+);
+
+ALTER TABLE ONLY partial_trace_snapshots
+    ADD CONSTRAINT partial_trace_snapshots_pkey PRIMARY KEY (tenant, span_id, trace_id);
+
+CREATE INDEX idx_partial_trace_snapshots_last_snapshot_at ON partial_trace_snapshots USING btree (last_snapshot_at);
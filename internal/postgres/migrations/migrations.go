@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// FS holds the schema migrations of the partial trace store.
+//
+//go:embed *.sql
+var FS embed.FS
+
+// Up applies the pending schema migrations to the database at the connection URL.
+func Up(conn string) error {
+	driverURL, err := URL(conn)
+	if err != nil {
+		return err
+	}
+
+	src, err := iofs.New(FS, ".")
+	if err != nil {
+		return fmt.Errorf("failed to open migrations: %w", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", src, driverURL)
+	if err != nil {
+		return fmt.Errorf("failed to create migration: %w", err)
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to run migration: %w", err)
+	}
+
+	return nil
+}
+
+// URL converts a postgres connection URL to the URL of the migration driver.
+func URL(conn string) (string, error) {
+	u, err := url.Parse(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse connection URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		u.Scheme = "pgx5"
+	case "pgx5":
+	default:
+		return "", fmt.Errorf("unsupported connection URL scheme %q", u.Scheme)
+	}
+
+	return u.String(), nil
+}
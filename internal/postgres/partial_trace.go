@@ -2,27 +2,86 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type PartialTrace struct {
+	// Tenant owns the trace, traces of different tenants never collide
+	Tenant  string
 	TraceID string
 	SpanID  string
 	// Marshaled trace to byte slice
 	Trace     []byte
 	Timestamp time.Time
 	ExpiresAt time.Time
+	// HeartbeatInterval is the heartbeat frequency reported by the producer
+	HeartbeatInterval time.Duration
+	// ServiceName is the service.name resource attribute of the span
+	ServiceName string
+	// SpanName is the name of the span
+	SpanName string
+	// StartTime is the start time of the span
+	StartTime time.Time
+	// Forced is set when the trace is expired on demand instead of by missing heartbeats
+	Forced bool
+	// Evicted is set when the trace is expired early to enforce the quotas
+	Evicted bool
+	// LifetimeExpiresAt is the time the trace expires regardless of the heartbeats.
+	// It is set when the trace is first stored and the zero value means no limit.
+	LifetimeExpiresAt time.Time
+	// ExpiresAfter, when set, makes the database compute the times from its own clock:
+	// Timestamp is now() and ExpiresAt is now() plus ExpiresAfter.
+	ExpiresAfter time.Duration
+	// LifetimeExpiresAfter, when set, makes the database compute LifetimeExpiresAt as now()
+	// plus LifetimeExpiresAfter.
+	LifetimeExpiresAfter time.Duration
+	// IfNewer makes the stored trace replaced only by a trace with a later or equal Timestamp,
+	// for heartbeats not stored in the order of their timestamps.
+	IfNewer bool
+	// PreviousGCReason is set when the trace is stored again after the gc emitted it for
+	// that reason, at PreviousGCAt.
+	PreviousGCReason string
+	PreviousGCAt     time.Time
+	// DeadLetterReason is set when the receiver failed to emit the trace permanently
+	DeadLetterReason string
 }
 
+// ErrTraceNotFound is returned when the partial trace doesn't exist.
+var ErrTraceNotFound = errors.New("partial trace not found")
+
 func (db *DB) PutTrace(ctx context.Context, partialTrace *PartialTrace) error {
 	q := `
 INSERT INTO partial_traces
-(trace_id, span_id, trace, timestamp, expires_at)
+(trace_id, span_id, trace, timestamp, expires_at, heartbeat_interval, service_name, span_name, start_time, tenant, lifetime_expires_at,
+	previous_gc_reason, previous_gc_at)
 VALUES
-($1, $2, $3, $4, $5)
-ON CONFLICT (trace_id, span_id) DO UPDATE
-SET trace = $3, timestamp = $4, expires_at = $5
+(
+	$1, $2, $3,
+	-- the intervals are set to use the clock of the database instead of the times
+	CASE WHEN $12::interval IS NULL THEN $4::timestamptz ELSE now() END,
+	LEAST(COALESCE(now() + $12::interval, $5), COALESCE(now() + $13::interval, $11)),
+	$6, $7, $8, $9, $10,
+	COALESCE(now() + $13::interval, $11),
+	NULLIF($15, ''), $16
+)
+ON CONFLICT (tenant, span_id, trace_id) DO UPDATE
+SET trace = $3, timestamp = EXCLUDED.timestamp, heartbeat_interval = $6, service_name = $7, span_name = $8, start_time = $9,
+	-- heartbeats must not postpone traces expired on demand nor past their lifetime,
+	-- which is kept from the first heartbeat
+	expires_at = CASE
+		WHEN partial_traces.forced THEN partial_traces.expires_at
+		ELSE LEAST(COALESCE(now() + $12::interval, $5), partial_traces.lifetime_expires_at)
+	END,
+	-- the new heartbeat replaces the trace that failed to be emitted
+	dead_lettered_at = NULL, dead_letter_reason = NULL,
+	previous_gc_reason = COALESCE(EXCLUDED.previous_gc_reason, partial_traces.previous_gc_reason),
+	previous_gc_at = COALESCE(EXCLUDED.previous_gc_at, partial_traces.previous_gc_at)
+WHERE NOT $14 OR partial_traces.timestamp <= EXCLUDED.timestamp
 `
 
 	if _, err := db.Exec(
@@ -33,6 +92,17 @@ SET trace = $3, timestamp = $4, expires_at = $5
 		partialTrace.Trace,
 		partialTrace.Timestamp,
 		partialTrace.ExpiresAt,
+		partialTrace.HeartbeatInterval,
+		partialTrace.ServiceName,
+		partialTrace.SpanName,
+		partialTrace.StartTime,
+		partialTrace.Tenant,
+		nullTime(partialTrace.LifetimeExpiresAt),
+		nullDuration(partialTrace.ExpiresAfter),
+		nullDuration(partialTrace.LifetimeExpiresAfter),
+		partialTrace.IfNewer,
+		partialTrace.PreviousGCReason,
+		nullTime(partialTrace.PreviousGCAt),
 	); err != nil {
 		return fmt.Errorf("failed to insert partial span: %w", err)
 	}
@@ -40,27 +110,348 @@ SET trace = $3, timestamp = $4, expires_at = $5
 	return nil
 }
 
-func (db *DB) RemoveTrace(ctx context.Context, traceID, spanID string) error {
+func (db *DB) RemoveTrace(ctx context.Context, tenant, traceID, spanID string) error {
 	q := `
 DELETE FROM partial_traces
-WHERE trace_id = $1 AND span_id = $2
+WHERE trace_id = $1 AND span_id = $2 AND tenant = $3
 	`
 
-	if _, err := db.Exec(ctx, q, traceID, spanID); err != nil {
+	if _, err := db.Exec(ctx, q, traceID, spanID, tenant); err != nil {
 		return fmt.Errorf("failed to delete partial span: %w", err)
 	}
 
 	return nil
 }
 
-func (db *DB) ListExpiredTraces(ctx context.Context, timestamp time.Time) ([]*PartialTrace, error) {
+// ListExpiredTraces returns traces expired before the timestamp, oldest expiration first.
+// At most limit traces are returned, unless limit is 0.
+func (db *DB) ListExpiredTraces(ctx context.Context, timestamp time.Time, limit int) ([]*PartialTrace, error) {
 	q := `
-SELECT trace_id, span_id, trace FROM partial_traces
-WHERE expires_at < $1
+SELECT tenant, trace_id, span_id, trace, timestamp, expires_at, heartbeat_interval, forced, evicted, lifetime_expires_at,
+	COALESCE(previous_gc_reason, ''), previous_gc_at
+FROM partial_traces
+WHERE expires_at < $1 AND dead_lettered_at IS NULL
+ORDER BY expires_at
+LIMIT NULLIF($2::int, 0)
 FOR UPDATE SKIP LOCKED
 	`
 
-	rows, err := db.Query(ctx, q, timestamp)
+	rows, err := db.Query(ctx, q, timestamp, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query traces: %w", err)
+	}
+	defer rows.Close()
+
+	var traces []*PartialTrace
+	for rows.Next() {
+		var trace PartialTrace
+		var lifetimeExpiresAt, previousGCAt *time.Time
+		if err := rows.Scan(
+			&trace.Tenant,
+			&trace.TraceID,
+			&trace.SpanID,
+			&trace.Trace,
+			&trace.Timestamp,
+			&trace.ExpiresAt,
+			&trace.HeartbeatInterval,
+			&trace.Forced,
+			&trace.Evicted,
+			&lifetimeExpiresAt,
+			&trace.PreviousGCReason,
+			&previousGCAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if lifetimeExpiresAt != nil {
+			trace.LifetimeExpiresAt = *lifetimeExpiresAt
+		}
+		if previousGCAt != nil {
+			trace.PreviousGCAt = *previousGCAt
+		}
+		traces = append(traces, &trace)
+	}
+
+	return traces, nil
+}
+
+func (db *DB) CountExpiredTraces(ctx context.Context, timestamp time.Time) (int64, error) {
+	q := `
+SELECT COUNT(*) FROM partial_traces
+WHERE expires_at < $1 AND dead_lettered_at IS NULL
+	`
+
+	var count int64
+	if err := db.QueryRow(ctx, q, timestamp).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count expired traces: %w", err)
+	}
+
+	return count, nil
+}
+
+// TraceFilter filters the traces. Zero values don't filter.
+type TraceFilter struct {
+	Tenant      string
+	ServiceName string
+	SpanName    string
+	// ExpiredBefore matches only the traces expired before the time
+	ExpiredBefore time.Time
+	// Expired matches only the traces expired at the time of the database, when ExpiredBefore is zero
+	Expired bool
+	// StartedBefore matches only the traces of spans started before the time
+	StartedBefore time.Time
+	// DeadLettered matches only the traces the receiver failed to emit permanently
+	DeadLettered bool
+	// NotDeadLettered matches only the traces not dead-lettered
+	NotDeadLettered bool
+	Limit           int
+}
+
+// where returns the WHERE clause of the filter, with the arguments appended to args.
+func (f *TraceFilter) where(args []any) (string, []any) {
+	var conditions []string
+	if f.Tenant != "" {
+		args = append(args, f.Tenant)
+		conditions = append(conditions, fmt.Sprintf("tenant = $%d", len(args)))
+	}
+	if f.ServiceName != "" {
+		args = append(args, f.ServiceName)
+		conditions = append(conditions, fmt.Sprintf("service_name = $%d", len(args)))
+	}
+	if f.SpanName != "" {
+		args = append(args, f.SpanName)
+		conditions = append(conditions, fmt.Sprintf("span_name = $%d", len(args)))
+	}
+	if !f.ExpiredBefore.IsZero() {
+		args = append(args, f.ExpiredBefore)
+		conditions = append(conditions, fmt.Sprintf("expires_at < $%d", len(args)))
+	} else if f.Expired {
+		conditions = append(conditions, "expires_at < now()")
+	}
+	if !f.StartedBefore.IsZero() {
+		args = append(args, f.StartedBefore)
+		conditions = append(conditions, fmt.Sprintf("COALESCE(start_time, timestamp) < $%d", len(args)))
+	}
+	if f.DeadLettered {
+		conditions = append(conditions, "dead_lettered_at IS NOT NULL")
+	}
+	if f.NotDeadLettered {
+		conditions = append(conditions, "dead_lettered_at IS NULL")
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND ") + "\n", args
+}
+
+func (f *TraceFilter) isEmpty() bool {
+	where, _ := f.where(nil)
+	return where == ""
+}
+
+// ListTraces returns the traces matching the filter, oldest expiration first.
+// The marshaled trace is not returned, use GetTrace instead.
+func (db *DB) ListTraces(ctx context.Context, filter TraceFilter) ([]*PartialTrace, error) {
+	where, args := filter.where(nil)
+	q := `
+SELECT tenant, trace_id, span_id, timestamp, expires_at, heartbeat_interval, service_name, span_name, COALESCE(start_time, timestamp), forced,
+	evicted, COALESCE(dead_letter_reason, '')
+FROM partial_traces
+` + where
+	args = append(args, filter.Limit)
+	q += fmt.Sprintf("ORDER BY expires_at\nLIMIT NULLIF($%d::int, 0)", len(args))
+
+	rows, err := db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query traces: %w", err)
+	}
+	defer rows.Close()
+
+	var traces []*PartialTrace
+	for rows.Next() {
+		var trace PartialTrace
+		if err := rows.Scan(
+			&trace.Tenant,
+			&trace.TraceID,
+			&trace.SpanID,
+			&trace.Timestamp,
+			&trace.ExpiresAt,
+			&trace.HeartbeatInterval,
+			&trace.ServiceName,
+			&trace.SpanName,
+			&trace.StartTime,
+			&trace.Forced,
+			&trace.Evicted,
+			&trace.DeadLetterReason,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		traces = append(traces, &trace)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	return traces, nil
+}
+
+// GetTrace returns the trace, or ErrTraceNotFound if it doesn't exist.
+func (db *DB) GetTrace(ctx context.Context, tenant, traceID, spanID string) (*PartialTrace, error) {
+	q := `
+SELECT tenant, trace_id, span_id, trace, timestamp, expires_at, heartbeat_interval, service_name, span_name, COALESCE(start_time, timestamp), forced,
+	evicted, COALESCE(dead_letter_reason, '')
+FROM partial_traces
+WHERE trace_id = $1 AND span_id = $2 AND tenant = $3
+	`
+
+	var trace PartialTrace
+	if err := db.QueryRow(ctx, q, traceID, spanID, tenant).Scan(
+		&trace.Tenant,
+		&trace.TraceID,
+		&trace.SpanID,
+		&trace.Trace,
+		&trace.Timestamp,
+		&trace.ExpiresAt,
+		&trace.HeartbeatInterval,
+		&trace.ServiceName,
+		&trace.SpanName,
+		&trace.StartTime,
+		&trace.Forced,
+		&trace.Evicted,
+		&trace.DeadLetterReason,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTraceNotFound
+		}
+		return nil, fmt.Errorf("failed to get trace: %w", err)
+	}
+
+	return &trace, nil
+}
+
+// ExpireTrace expires the trace at the timestamp, or at the time of the database when it is zero,
+// so it is collected by the next gc cycle regardless of the heartbeats. It returns ErrTraceNotFound
+// if the trace doesn't exist.
+func (db *DB) ExpireTrace(ctx context.Context, tenant, traceID, spanID string, timestamp time.Time) error {
+	q := `
+UPDATE partial_traces
+SET expires_at = COALESCE($3, now()), forced = true
+WHERE trace_id = $1 AND span_id = $2 AND tenant = $4
+	`
+
+	tag, err := db.Exec(ctx, q, traceID, spanID, nullTime(timestamp), tenant)
+	if err != nil {
+		return fmt.Errorf("failed to expire trace: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTraceNotFound
+	}
+
+	return nil
+}
+
+// CountTraces returns the number of traces matching the filter. The limit is ignored.
+func (db *DB) CountTraces(ctx context.Context, filter TraceFilter) (int64, error) {
+	where, args := filter.where(nil)
+	q := "SELECT COUNT(*) FROM partial_traces\n" + where
+
+	var count int64
+	if err := db.QueryRow(ctx, q, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count traces: %w", err)
+	}
+
+	return count, nil
+}
+
+// RemoveTraces removes the traces matching the filter without emitting them and returns
+// the number of removed traces. The limit is ignored and the filter cannot be empty.
+func (db *DB) RemoveTraces(ctx context.Context, filter TraceFilter) (int64, error) {
+	if filter.isEmpty() {
+		return 0, errors.New("refusing to remove traces without a filter")
+	}
+
+	where, args := filter.where(nil)
+	q := "DELETE FROM partial_traces\n" + where
+
+	tag, err := db.Exec(ctx, q, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete partial spans: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// DeadLetterTrace excludes the trace from the gc, since it can never be emitted.
+// The trace is retried when it is requeued or a new heartbeat replaces it.
+func (db *DB) DeadLetterTrace(ctx context.Context, tenant, traceID, spanID, reason string) error {
+	q := `
+UPDATE partial_traces
+SET dead_lettered_at = now(), dead_letter_reason = $3
+WHERE trace_id = $1 AND span_id = $2 AND tenant = $4
+	`
+
+	if _, err := db.Exec(ctx, q, traceID, spanID, reason, tenant); err != nil {
+		return fmt.Errorf("failed to dead letter trace: %w", err)
+	}
+
+	return nil
+}
+
+// RequeueDeadLetteredTraces makes the dead-lettered traces matching the filter subject to the gc again,
+// expiring them at the timestamp, or at the time of the database when it is zero. It returns the number
+// of requeued traces. The limit is ignored.
+func (db *DB) RequeueDeadLetteredTraces(ctx context.Context, filter TraceFilter, timestamp time.Time) (int64, error) {
+	filter.DeadLettered = true
+	where, args := filter.where([]any{nullTime(timestamp)})
+	q := `
+UPDATE partial_traces
+SET dead_lettered_at = NULL, dead_letter_reason = NULL, expires_at = COALESCE($1::timestamptz, now())
+` + where
+
+	tag, err := db.Exec(ctx, q, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue traces: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// nullTime maps the zero time to NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// nullDuration maps the zero duration to NULL.
+func nullDuration(d time.Duration) *time.Duration {
+	if d == 0 {
+		return nil
+	}
+	return &d
+}
+
+// TraceKey identifies a stored trace.
+type TraceKey struct {
+	Tenant  string
+	TraceID string
+	SpanID  string
+}
+
+// ListTracesAfter returns up to limit traces, with all their fields, ordered by key after the given key.
+func (db *DB) ListTracesAfter(ctx context.Context, after TraceKey, limit int) ([]*PartialTrace, error) {
+	q := `
+SELECT tenant, trace_id, span_id, trace, timestamp, expires_at, heartbeat_interval, service_name, span_name,
+	COALESCE(start_time, timestamp), forced, evicted, lifetime_expires_at, COALESCE(dead_letter_reason, ''),
+	COALESCE(previous_gc_reason, ''), previous_gc_at
+FROM partial_traces
+WHERE (tenant, span_id, trace_id) > ($1, $2, $3)
+ORDER BY tenant, span_id, trace_id
+LIMIT $4
+	`
+
+	rows, err := db.Query(ctx, q, after.Tenant, after.SpanID, after.TraceID, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query traces: %w", err)
 	}
@@ -69,11 +460,77 @@ FOR UPDATE SKIP LOCKED
 	var traces []*PartialTrace
 	for rows.Next() {
 		var trace PartialTrace
-		if err := rows.Scan(&trace.TraceID, &trace.SpanID, &trace.Trace); err != nil {
+		var lifetimeExpiresAt, previousGCAt *time.Time
+		if err := rows.Scan(
+			&trace.Tenant,
+			&trace.TraceID,
+			&trace.SpanID,
+			&trace.Trace,
+			&trace.Timestamp,
+			&trace.ExpiresAt,
+			&trace.HeartbeatInterval,
+			&trace.ServiceName,
+			&trace.SpanName,
+			&trace.StartTime,
+			&trace.Forced,
+			&trace.Evicted,
+			&lifetimeExpiresAt,
+			&trace.DeadLetterReason,
+			&trace.PreviousGCReason,
+			&previousGCAt,
+		); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
+		if lifetimeExpiresAt != nil {
+			trace.LifetimeExpiresAt = *lifetimeExpiresAt
+		}
+		if previousGCAt != nil {
+			trace.PreviousGCAt = *previousGCAt
+		}
 		traces = append(traces, &trace)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
 
 	return traces, nil
 }
+
+// ImportTrace stores the trace with all its fields, as listed by ListTracesAfter. A trace
+// already stored is kept, since it is updated by newer heartbeats than the imported one.
+func (db *DB) ImportTrace(ctx context.Context, partialTrace *PartialTrace) error {
+	q := `
+INSERT INTO partial_traces
+(tenant, trace_id, span_id, trace, timestamp, expires_at, heartbeat_interval, service_name, span_name, start_time,
+	forced, evicted, lifetime_expires_at, dead_letter_reason, dead_lettered_at, previous_gc_reason, previous_gc_at)
+VALUES
+($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''), CASE WHEN $14 = '' THEN NULL ELSE now() END,
+	NULLIF($15, ''), $16)
+ON CONFLICT (tenant, span_id, trace_id) DO NOTHING
+	`
+
+	if _, err := db.Exec(
+		ctx,
+		q,
+		partialTrace.Tenant,
+		partialTrace.TraceID,
+		partialTrace.SpanID,
+		partialTrace.Trace,
+		partialTrace.Timestamp,
+		partialTrace.ExpiresAt,
+		partialTrace.HeartbeatInterval,
+		partialTrace.ServiceName,
+		partialTrace.SpanName,
+		partialTrace.StartTime,
+		partialTrace.Forced,
+		partialTrace.Evicted,
+		nullTime(partialTrace.LifetimeExpiresAt),
+		partialTrace.DeadLetterReason,
+		partialTrace.PreviousGCReason,
+		nullTime(partialTrace.PreviousGCAt),
+	); err != nil {
+		return fmt.Errorf("failed to import partial span: %w", err)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package postgres_test
 
 import (
 	"context"
+	"time"
 
 	"github.com/G-Research/otel-partial-collector/internal/postgres"
 	"github.com/stretchr/testify/require"
@@ -62,7 +63,7 @@ func (ts *TestSuite) TestDeleteTrace() {
 	err := db.PutTrace(context.Background(), partialTrace)
 	require.NoError(t, err, "failed to put the first trace")
 
-	err = db.RemoveTrace(ctx, partialTrace.TraceID, partialTrace.SpanID)
+	err = db.RemoveTrace(ctx, partialTrace.Tenant, partialTrace.TraceID, partialTrace.SpanID)
 	require.NoError(t, err)
 
 	var count int
@@ -71,3 +72,422 @@ func (ts *TestSuite) TestDeleteTrace() {
 
 	assert.Equal(t, 0, count)
 }
+
+func (ts *TestSuite) TestListExpiredTraces() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	expired := generatePartialTrace(t)
+	expired.Timestamp = now.Add(-time.Minute)
+	expired.ExpiresAt = now.Add(-time.Second)
+	expired.HeartbeatInterval = 10 * time.Second
+
+	live := generatePartialTrace(t)
+	live.Timestamp = now
+	live.ExpiresAt = now.Add(time.Minute)
+	live.HeartbeatInterval = 10 * time.Second
+
+	for _, pt := range []*postgres.PartialTrace{expired, live} {
+		err := db.PutTrace(ctx, pt)
+		require.NoError(t, err)
+	}
+
+	got, err := db.ListExpiredTraces(ctx, now, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, expired.TraceID, got[0].TraceID)
+	assert.Equal(t, expired.SpanID, got[0].SpanID)
+	assert.Equal(t, expired.HeartbeatInterval, got[0].HeartbeatInterval)
+	assert.Assert(t, expired.Timestamp.Equal(got[0].Timestamp))
+	assert.Assert(t, expired.ExpiresAt.Equal(got[0].ExpiresAt))
+}
+
+func (ts *TestSuite) TestListExpiredTracesLimit() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	var oldest *postgres.PartialTrace
+	for i := range 3 {
+		pt := generatePartialTrace(t)
+		pt.Timestamp = now.Add(-time.Minute)
+		pt.ExpiresAt = now.Add(-time.Duration(i+1) * time.Second)
+		oldest = pt
+		err := db.PutTrace(ctx, pt)
+		require.NoError(t, err)
+	}
+
+	count, err := db.CountExpiredTraces(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	got, err := db.ListExpiredTraces(ctx, now, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(got))
+	assert.Equal(t, oldest.SpanID, got[0].SpanID)
+}
+
+func (ts *TestSuite) TestListTraces() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC()
+	for _, serviceName := range []string{"checkout", "checkout", "billing"} {
+		pt := generatePartialTrace(t)
+		pt.ServiceName = serviceName
+		pt.Timestamp = now
+		pt.ExpiresAt = now.Add(time.Minute)
+		err := db.PutTrace(ctx, pt)
+		require.NoError(t, err)
+	}
+
+	got, err := db.ListTraces(ctx, postgres.TraceFilter{ServiceName: "checkout"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(got))
+
+	got, err = db.ListTraces(ctx, postgres.TraceFilter{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+
+	got, err = db.ListTraces(ctx, postgres.TraceFilter{ExpiredBefore: now})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(got))
+
+	got, err = db.ListTraces(ctx, postgres.TraceFilter{Expired: true})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(got))
+}
+
+func (ts *TestSuite) TestExpireTrace() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC()
+	pt := generatePartialTrace(t)
+	pt.Timestamp = now
+	pt.ExpiresAt = now.Add(time.Hour)
+	err := db.PutTrace(ctx, pt)
+	require.NoError(t, err)
+
+	err = db.ExpireTrace(ctx, pt.Tenant, pt.TraceID, pt.SpanID, now)
+	require.NoError(t, err)
+
+	// heartbeat after the trace is expired on demand must not postpone it
+	err = db.PutTrace(ctx, pt)
+	require.NoError(t, err)
+
+	got, err := db.ListExpiredTraces(ctx, now.Add(time.Second), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+	assert.Assert(t, got[0].Forced)
+
+	err = db.ExpireTrace(ctx, pt.Tenant, pt.TraceID, newSpanID(t).String(), now)
+	assert.ErrorIs(t, err, postgres.ErrTraceNotFound)
+
+	// the zero timestamp expires the trace at the time of the database
+	err = db.ExpireTrace(ctx, pt.Tenant, pt.TraceID, pt.SpanID, time.Time{})
+	require.NoError(t, err)
+	got, err = db.ListTraces(ctx, postgres.TraceFilter{Expired: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+
+	_, err = db.GetTrace(ctx, pt.Tenant, pt.TraceID, newSpanID(t).String())
+	assert.ErrorIs(t, err, postgres.ErrTraceNotFound)
+}
+
+func (ts *TestSuite) TestRemoveTraces() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC()
+	for _, serviceName := range []string{"checkout", "checkout", "billing"} {
+		pt := generatePartialTrace(t)
+		pt.ServiceName = serviceName
+		pt.Timestamp = now
+		pt.ExpiresAt = now.Add(time.Minute)
+		err := db.PutTrace(ctx, pt)
+		require.NoError(t, err)
+	}
+
+	_, err := db.RemoveTraces(ctx, postgres.TraceFilter{})
+	assert.ErrorContains(t, err, "without a filter")
+
+	removed, err := db.RemoveTraces(ctx, postgres.TraceFilter{ServiceName: "checkout"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), removed)
+
+	count, err := db.CountTraces(ctx, postgres.TraceFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func (ts *TestSuite) TestDeadLetterTrace() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC()
+	pt := generatePartialTrace(t)
+	pt.Timestamp = now
+	pt.ExpiresAt = now
+	err := db.PutTrace(ctx, pt)
+	require.NoError(t, err)
+
+	err = db.DeadLetterTrace(ctx, pt.Tenant, pt.TraceID, pt.SpanID, "invalid trace")
+	require.NoError(t, err)
+
+	got, err := db.ListExpiredTraces(ctx, now.Add(time.Second), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(got))
+
+	deadLettered, err := db.ListTraces(ctx, postgres.TraceFilter{DeadLettered: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(deadLettered))
+	assert.Equal(t, "invalid trace", deadLettered[0].DeadLetterReason)
+
+	// the dead-lettered trace is expired but excluded from the expired traces not dead-lettered
+	count, err := db.CountTraces(ctx, postgres.TraceFilter{ExpiredBefore: now.Add(time.Second), NotDeadLettered: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	requeued, err := db.RequeueDeadLetteredTraces(ctx, postgres.TraceFilter{}, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), requeued)
+
+	got, err = db.ListExpiredTraces(ctx, now.Add(time.Second), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+}
+
+func (ts *TestSuite) TestTenantIsolation() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC()
+	pt := generatePartialTrace(t)
+	pt.Timestamp = now
+	pt.ExpiresAt = now.Add(time.Minute)
+	for _, tenant := range []string{"team-a", "team-b"} {
+		pt.Tenant = tenant
+		err := db.PutTrace(ctx, pt)
+		require.NoError(t, err)
+	}
+
+	got, err := db.ListTraces(ctx, postgres.TraceFilter{Tenant: "team-a"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(got))
+	assert.Equal(t, "team-a", got[0].Tenant)
+
+	err = db.RemoveTrace(ctx, "team-a", pt.TraceID, pt.SpanID)
+	require.NoError(t, err)
+
+	_, err = db.GetTrace(ctx, "team-a", pt.TraceID, pt.SpanID)
+	assert.ErrorIs(t, err, postgres.ErrTraceNotFound)
+
+	got2, err := db.GetTrace(ctx, "team-b", pt.TraceID, pt.SpanID)
+	require.NoError(t, err)
+	assert.Equal(t, "team-b", got2.Tenant)
+}
+
+func (ts *TestSuite) TestListTracesAfterAndImport() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC()
+	for range 3 {
+		pt := generatePartialTrace(t)
+		pt.Timestamp = now
+		pt.ExpiresAt = now.Add(time.Minute)
+		err := db.PutTrace(ctx, pt)
+		require.NoError(t, err)
+	}
+
+	first, err := db.ListTracesAfter(ctx, postgres.TraceKey{}, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(first))
+
+	last := first[1]
+	rest, err := db.ListTracesAfter(ctx, postgres.TraceKey{Tenant: last.Tenant, TraceID: last.TraceID, SpanID: last.SpanID}, 2)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(rest))
+
+	err = db.RemoveTrace(ctx, rest[0].Tenant, rest[0].TraceID, rest[0].SpanID)
+	require.NoError(t, err)
+
+	rest[0].DeadLetterReason = "invalid trace"
+	err = db.ImportTrace(ctx, rest[0])
+	require.NoError(t, err)
+
+	got, err := db.GetTrace(ctx, rest[0].Tenant, rest[0].TraceID, rest[0].SpanID)
+	require.NoError(t, err)
+	assert.Equal(t, "invalid trace", got.DeadLetterReason)
+	assert.DeepEqual(t, rest[0].Trace, got.Trace)
+}
+
+func (ts *TestSuite) TestDatabaseClock() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now, err := db.Now(ctx)
+	require.NoError(t, err)
+
+	// the times of the trace are computed from the clock of the database, whatever the local times
+	pt := generatePartialTrace(t)
+	pt.ExpiresAfter = time.Minute
+	pt.LifetimeExpiresAfter = time.Hour
+	err = db.PutTrace(ctx, pt)
+	require.NoError(t, err)
+
+	expired, err := db.ListExpiredTraces(ctx, now, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(expired))
+
+	expired, err = db.ListExpiredTraces(ctx, now.Add(2*time.Minute), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(expired))
+	got := expired[0]
+	assert.Assert(t, !got.Timestamp.Before(now))
+	assert.Assert(t, got.ExpiresAt.Equal(got.Timestamp.Add(time.Minute)))
+	assert.Assert(t, got.LifetimeExpiresAt.Equal(got.Timestamp.Add(time.Hour)))
+}
+
+func (ts *TestSuite) TestPutTraceIfNewer() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	pt := generatePartialTrace(t)
+	pt.Timestamp = now
+	pt.ExpiresAt = now.Add(time.Minute)
+	pt.IfNewer = true
+	err := db.PutTrace(ctx, pt)
+	require.NoError(t, err)
+
+	// an older heartbeat received late doesn't replace the stored trace
+	late := *pt
+	late.Timestamp = now.Add(-time.Second)
+	late.ExpiresAt = late.Timestamp.Add(time.Minute)
+	err = db.PutTrace(ctx, &late)
+	require.NoError(t, err)
+
+	got, err := db.GetTrace(ctx, pt.Tenant, pt.TraceID, pt.SpanID)
+	require.NoError(t, err)
+	assert.Assert(t, got.Timestamp.Equal(now))
+	assert.Assert(t, got.ExpiresAt.Equal(now.Add(time.Minute)))
+
+	newer := *pt
+	newer.Timestamp = now.Add(time.Second)
+	newer.ExpiresAt = newer.Timestamp.Add(time.Minute)
+	err = db.PutTrace(ctx, &newer)
+	require.NoError(t, err)
+
+	got, err = db.GetTrace(ctx, pt.Tenant, pt.TraceID, pt.SpanID)
+	require.NoError(t, err)
+	assert.Assert(t, got.Timestamp.Equal(newer.Timestamp))
+}
+
+func (ts *TestSuite) TestResurrectedTrace() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	pt := generatePartialTrace(t)
+	pt.Timestamp = now
+	pt.ExpiresAt = now.Add(time.Minute)
+	pt.PreviousGCReason = "expired"
+	pt.PreviousGCAt = now.Add(-time.Minute)
+	err := db.PutTrace(ctx, pt)
+	require.NoError(t, err)
+
+	// the previous emission is kept by the later heartbeats
+	next := *pt
+	next.PreviousGCReason = ""
+	next.PreviousGCAt = time.Time{}
+	err = db.PutTrace(ctx, &next)
+	require.NoError(t, err)
+
+	expired, err := db.ListExpiredTraces(ctx, now.Add(2*time.Minute), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(expired))
+	assert.Equal(t, "expired", expired[0].PreviousGCReason)
+	assert.Assert(t, expired[0].PreviousGCAt.Equal(pt.PreviousGCAt))
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DB struct {
@@ -18,14 +20,61 @@ type DB struct {
 	tx pgx.Tx
 }
 
-func NewDB(ctx context.Context, conn string) (*DB, error) {
-	pool, err := pgxpool.New(ctx, conn)
+type options struct {
+	tracerProvider trace.TracerProvider
+	attrs          []attribute.KeyValue
+	lazy           bool
+}
+
+// Option configures the connection to the database.
+type Option func(*options)
+
+// WithTracerProvider traces the queries with a tracer of the provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tp
+	}
+}
+
+// WithLazyConnect skips the ping of the database on creation, so NewDB succeeds
+// even if the database is unreachable. The connections are established on the
+// first queries, and established again after they are lost.
+func WithLazyConnect() Option {
+	return func(o *options) {
+		o.lazy = true
+	}
+}
+
+// withAttributes adds the attributes to the spans of the queries.
+func withAttributes(attrs ...attribute.KeyValue) Option {
+	return func(o *options) {
+		o.attrs = append(o.attrs, attrs...)
+	}
+}
+
+func NewDB(ctx context.Context, config Config, opts ...Option) (*DB, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cfg, err := config.poolConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if o.tracerProvider != nil {
+		cfg.ConnConfig.Tracer = &queryTracer{tracer: o.tracerProvider.Tracer(tracerName), attrs: o.attrs}
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new pgx pool: %w", err)
 	}
 
-	if err := pool.Ping(ctx); err != nil {
-		return nil, fmt.Errorf("failed to ping the database: %w", err)
+	if !o.lazy {
+		if err := pool.Ping(ctx); err != nil {
+			return nil, fmt.Errorf("failed to ping the database: %w", err)
+		}
 	}
 
 	return &DB{
@@ -33,6 +82,20 @@ func NewDB(ctx context.Context, conn string) (*DB, error) {
 	}, nil
 }
 
+// Now returns the time of the database clock.
+func (db *DB) Now(ctx context.Context) (time.Time, error) {
+	var now time.Time
+	if err := db.QueryRow(ctx, "SELECT now()").Scan(&now); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get the database time: %w", err)
+	}
+	return now.UTC(), nil
+}
+
+// Ping checks the connectivity to the database.
+func (db *DB) Ping(ctx context.Context) error {
+	return db.pool.Ping(ctx)
+}
+
 func (db *DB) Close() error {
 	if db.pool == nil {
 		return errors.New("pool is nil")
@@ -59,7 +59,7 @@ func (hs *TestSuite) SetupSuite() {
 	err = tp.Migration(migrationDir)
 	require.NoError(t, err, "failed to run migration")
 
-	hs.tp.db, err = postgres.NewDB(ctx, cfg.DBConnStr())
+	hs.tp.db, err = postgres.NewDB(ctx, postgres.Config{URL: cfg.DBConnStr()})
 	require.NoError(t, err)
 }
 
@@ -73,15 +73,43 @@ func (hs *TestSuite) releaseDB() {
 }
 
 func (tp *TestPostgres) Migration(dir string) error {
+	return migrateDB(dir, tp.cfg)
+}
+
+// CreateDatabase creates and migrates another database in the container, for the tests of the shards.
+func (tp *TestPostgres) CreateDatabase(ctx context.Context, name string) (InstanceConfig, error) {
+	cfg := tp.cfg
+	cfg.DBName = name
+	if _, err := tp.db.Exec(ctx, fmt.Sprintf("CREATE DATABASE %q", name)); err != nil {
+		return cfg, fmt.Errorf("failed to create database %q: %w", name, err)
+	}
+
+	dir, err := migrationDir()
+	if err != nil {
+		return cfg, fmt.Errorf("failed to find migration directory: %w", err)
+	}
+
+	return cfg, migrateDB(dir, cfg)
+}
+
+// DropDatabase drops a database created with CreateDatabase.
+func (tp *TestPostgres) DropDatabase(ctx context.Context, name string) error {
+	if _, err := tp.db.Exec(ctx, fmt.Sprintf("DROP DATABASE %q WITH (FORCE)", name)); err != nil {
+		return fmt.Errorf("failed to drop database %q: %w", name, err)
+	}
+	return nil
+}
+
+func migrateDB(dir string, cfg InstanceConfig) error {
 	absPath, err := filepath.Abs(dir)
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
 	d := "file://" + absPath
-	m, err := migrate.New(d, tp.cfg.MigrationConnStr())
+	m, err := migrate.New(d, cfg.MigrationConnStr())
 	if err != nil {
-		return fmt.Errorf("failed to create migration on conn %q: %w", tp.cfg.MigrationConnStr(), err)
+		return fmt.Errorf("failed to create migration on conn %q: %w", cfg.MigrationConnStr(), err)
 	}
 	defer m.Close()
 	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
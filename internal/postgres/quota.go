@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TraceExists reports whether the trace is stored.
+func (db *DB) TraceExists(ctx context.Context, tenant, traceID, spanID string) (bool, error) {
+	q := `
+SELECT EXISTS (SELECT 1 FROM partial_traces WHERE trace_id = $1 AND span_id = $2 AND tenant = $3)
+	`
+
+	var exists bool
+	if err := db.QueryRow(ctx, q, traceID, spanID, tenant).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check trace: %w", err)
+	}
+
+	return exists, nil
+}
+
+// CountQuotaUsage returns the number of stored traces counted against the quotas, for the service
+// and in total. Evicted traces are not counted, since they are about to be collected. The counts
+// are read from the per-service usage kept up to date by triggers on the partial traces, instead of
+// counting the traces.
+func (db *DB) CountQuotaUsage(ctx context.Context, serviceName string) (int64, int64, error) {
+	q := `
+SELECT COALESCE(SUM(count) FILTER (WHERE service_name = $1), 0)::bigint, COALESCE(SUM(count), 0)::bigint
+FROM partial_trace_quota_usage
+	`
+
+	var service, total int64
+	if err := db.QueryRow(ctx, q, serviceName).Scan(&service, &total); err != nil {
+		return 0, 0, fmt.Errorf("failed to count quota usage: %w", err)
+	}
+
+	return service, total, nil
+}
+
+// EvictTraces expires the n oldest traces of the service, or of all services when the service
+// name is empty, so they are collected by the next gc cycle with the evicted reason. The traces
+// expire at the timestamp, or at the time of the database when it is zero.
+// It returns the number of evicted traces.
+func (db *DB) EvictTraces(ctx context.Context, serviceName string, n int, timestamp time.Time) (int64, error) {
+	q := `
+UPDATE partial_traces
+SET expires_at = COALESCE($3, now()), forced = true, evicted = true
+WHERE (tenant, trace_id, span_id) IN (
+	SELECT tenant, trace_id, span_id FROM partial_traces
+	WHERE NOT evicted AND ($1 = '' OR service_name = $1)
+	ORDER BY COALESCE(start_time, timestamp)
+	LIMIT $2
+	FOR UPDATE SKIP LOCKED
+)
+	`
+
+	tag, err := db.Exec(ctx, q, serviceName, n, nullTime(timestamp))
+	if err != nil {
+		return 0, fmt.Errorf("failed to evict traces: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,78 @@
+package postgres_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"github.com/stretchr/testify/require"
+	"gotest.tools/v3/assert"
+)
+
+func (ts *TestSuite) TestQuota() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC()
+	var oldestID string
+	var billing *postgres.PartialTrace
+	for i, serviceName := range []string{"checkout", "checkout", "billing"} {
+		pt := generatePartialTrace(t)
+		pt.ServiceName = serviceName
+		pt.Timestamp = now
+		pt.StartTime = now.Add(time.Duration(i) * time.Second)
+		pt.ExpiresAt = now.Add(time.Minute)
+		err := db.PutTrace(ctx, pt)
+		require.NoError(t, err)
+		billing = pt
+		if i == 0 {
+			oldestID = pt.SpanID
+
+			exists, err := db.TraceExists(ctx, pt.Tenant, pt.TraceID, pt.SpanID)
+			require.NoError(t, err)
+			assert.Assert(t, exists)
+		}
+	}
+
+	service, total, err := db.CountQuotaUsage(ctx, "checkout")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), service)
+	assert.Equal(t, int64(3), total)
+
+	evicted, err := db.EvictTraces(ctx, "checkout", 1, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), evicted)
+
+	service, total, err = db.CountQuotaUsage(ctx, "checkout")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), service)
+	assert.Equal(t, int64(2), total)
+
+	got, err := db.ListExpiredTraces(ctx, now.Add(time.Second), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, oldestID, got[0].SpanID)
+	assert.Assert(t, got[0].Evicted)
+
+	// heartbeats of stored traces are not counted again
+	err = db.PutTrace(ctx, billing)
+	require.NoError(t, err)
+	service, total, err = db.CountQuotaUsage(ctx, "billing")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), service)
+	assert.Equal(t, int64(2), total)
+
+	err = db.RemoveTrace(ctx, billing.Tenant, billing.TraceID, billing.SpanID)
+	require.NoError(t, err)
+	service, total, err = db.CountQuotaUsage(ctx, "billing")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), service)
+	assert.Equal(t, int64(1), total)
+}
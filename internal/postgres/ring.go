@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+)
+
+// ringReplicas is the number of points of each shard on the ring. More points spread
+// the traces more evenly between the shards.
+const ringReplicas = 128
+
+// ring maps keys to shards with consistent hashing, so adding a shard only moves
+// the keys it takes over from the other shards.
+type ring struct {
+	hashes []uint64
+	shards []int
+}
+
+// newRing places the shards on the ring by name, so the mapping doesn't depend
+// on the order of the shards.
+func newRing(names []string) *ring {
+	type point struct {
+		hash  uint64
+		shard int
+	}
+
+	points := make([]point, 0, len(names)*ringReplicas)
+	for i, name := range names {
+		for replica := range ringReplicas {
+			points = append(points, point{hash: hash(name + "#" + strconv.Itoa(replica)), shard: i})
+		}
+	}
+	slices.SortFunc(points, func(a, b point) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		default:
+			return a.shard - b.shard
+		}
+	})
+
+	r := &ring{
+		hashes: make([]uint64, len(points)),
+		shards: make([]int, len(points)),
+	}
+	for i, p := range points {
+		r.hashes[i] = p.hash
+		r.shards[i] = p.shard
+	}
+	return r
+}
+
+// shard returns the index of the shard owning the key.
+func (r *ring) shard(key string) int {
+	h := hash(key)
+	i, _ := slices.BinarySearch(r.hashes, h)
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.shards[i]
+}
+
+// hash returns the FNV-1a hash of the string, mixed with the splitmix64 finalizer
+// since FNV alone spreads similar strings, like the shard points, poorly.
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gotest.tools/v3/assert"
+)
+
+func TestRing(t *testing.T) {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%032x", i)
+	}
+
+	r := newRing([]string{"a", "b", "c"})
+	counts := make([]int, 3)
+	for _, key := range keys {
+		counts[r.shard(key)]++
+	}
+	for _, count := range counts {
+		// every shard owns a fair share of the keys
+		assert.Assert(t, count > 2000, "unbalanced shards: %v", counts)
+	}
+
+	// the mapping doesn't depend on the order of the shards
+	reordered := newRing([]string{"c", "a", "b"})
+	names := []string{"a", "b", "c"}
+	reorderedNames := []string{"c", "a", "b"}
+	for _, key := range keys {
+		require.Equal(t, names[r.shard(key)], reorderedNames[reordered.shard(key)])
+	}
+
+	// adding a shard only moves keys to the new shard
+	grown := newRing([]string{"a", "b", "c", "d"})
+	var moved int
+	for _, key := range keys {
+		before, after := r.shard(key), grown.shard(key)
+		if before != after {
+			require.Equal(t, 3, after)
+			moved++
+		}
+	}
+	assert.Assert(t, moved > 1500 && moved < 3500, "moved %d keys", moved)
+}
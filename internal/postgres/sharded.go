@@ -0,0 +1,351 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ShardConfig configures a database holding a shard of the partial traces.
+type ShardConfig struct {
+	// Name places the shard on the hash ring. Renaming a shard moves its traces to other shards.
+	Name string `mapstructure:"name"`
+	// Postgres configures the connection to the postgres instance of the shard.
+	Postgres Config `mapstructure:"postgres"`
+}
+
+// ResolveShards validates the database configuration of a component, which is either a single
+// postgres instance or a list of shards, and returns it as a list of shards. The connection
+// configurations are validated by their own Validate.
+func ResolveShards(conn Config, shards []ShardConfig) ([]ShardConfig, error) {
+	switch {
+	case !conn.empty() && len(shards) > 0:
+		return nil, errors.New("postgres and shards cannot be both configured")
+	case !conn.empty():
+		return []ShardConfig{{Name: "default", Postgres: conn}}, nil
+	case len(shards) == 0:
+		return nil, errors.New("either postgres or shards must be configured")
+	}
+
+	names := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		if shard.Name == "" {
+			return nil, errors.New("shard name cannot be empty")
+		}
+		if names[shard.Name] {
+			return nil, fmt.Errorf("duplicate shard name %q", shard.Name)
+		}
+		names[shard.Name] = true
+	}
+	return shards, nil
+}
+
+// ShardedDB spreads the partial traces between several databases by consistent
+// hashing on the trace id, so all the spans of a trace are stored in the same shard.
+type ShardedDB struct {
+	shards []*DB
+	names  []string
+	ring   *ring
+}
+
+// NewShardedDB connects to the shards. The spans of the queries have the
+// db.shard attribute set to the name of the shard.
+func NewShardedDB(ctx context.Context, shards []ShardConfig, opts ...Option) (*ShardedDB, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("no shards configured")
+	}
+
+	s := &ShardedDB{
+		names: make([]string, 0, len(shards)),
+	}
+	for _, shard := range shards {
+		db, err := NewDB(ctx, shard.Postgres, append(opts, withAttributes(attribute.String("db.shard", shard.Name)))...)
+		if err != nil {
+			_ = s.Close()
+			return nil, fmt.Errorf("failed to connect to shard %q: %w", shard.Name, err)
+		}
+		s.shards = append(s.shards, db)
+		s.names = append(s.names, shard.Name)
+	}
+	s.ring = newRing(s.names)
+
+	return s, nil
+}
+
+// Shards returns the databases of the shards.
+func (s *ShardedDB) Shards() []*DB {
+	return s.shards
+}
+
+// Name returns the name of the i-th shard.
+func (s *ShardedDB) Name(i int) string {
+	return s.names[i]
+}
+
+// ShardIndex returns the index of the shard owning the trace.
+func (s *ShardedDB) ShardIndex(traceID string) int {
+	return s.ring.shard(traceID)
+}
+
+// ForTrace returns the database of the shard owning the trace.
+func (s *ShardedDB) ForTrace(traceID string) *DB {
+	return s.shards[s.ShardIndex(traceID)]
+}
+
+func (s *ShardedDB) Close() error {
+	var errs []error
+	for _, db := range s.shards {
+		errs = append(errs, db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Now returns the time of the database of the first shard, for the times that are not
+// compared with the partial traces of a given shard.
+func (s *ShardedDB) Now(ctx context.Context) (time.Time, error) {
+	return s.shards[0].Now(ctx)
+}
+
+// Ping checks the connectivity to all the shards.
+func (s *ShardedDB) Ping(ctx context.Context) error {
+	var errs []error
+	for i, db := range s.shards {
+		if err := db.Ping(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shard %q: %w", s.Name(i), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *ShardedDB) PutTrace(ctx context.Context, partialTrace *PartialTrace) error {
+	return s.ForTrace(partialTrace.TraceID).PutTrace(ctx, partialTrace)
+}
+
+func (s *ShardedDB) RemoveTrace(ctx context.Context, tenant, traceID, spanID string) error {
+	return s.ForTrace(traceID).RemoveTrace(ctx, tenant, traceID, spanID)
+}
+
+func (s *ShardedDB) TraceExists(ctx context.Context, tenant, traceID, spanID string) (bool, error) {
+	return s.ForTrace(traceID).TraceExists(ctx, tenant, traceID, spanID)
+}
+
+func (s *ShardedDB) TouchTombstone(ctx context.Context, tenant, traceID, spanID string, expiresAt time.Time, expiresAfter time.Duration) (*Tombstone, error) {
+	return s.ForTrace(traceID).TouchTombstone(ctx, tenant, traceID, spanID, expiresAt, expiresAfter)
+}
+
+func (s *ShardedDB) RemoveTombstone(ctx context.Context, tenant, traceID, spanID string) error {
+	return s.ForTrace(traceID).RemoveTombstone(ctx, tenant, traceID, spanID)
+}
+
+// CountQuotaUsage sums the quota usage of all the shards.
+func (s *ShardedDB) CountQuotaUsage(ctx context.Context, serviceName string) (int64, int64, error) {
+	var service, total int64
+	for i, db := range s.shards {
+		shardService, shardTotal, err := db.CountQuotaUsage(ctx, serviceName)
+		if err != nil {
+			return 0, 0, fmt.Errorf("shard %q: %w", s.names[i], err)
+		}
+		service += shardService
+		total += shardTotal
+	}
+	return service, total, nil
+}
+
+// EvictTraces evicts the n oldest traces of each shard in turn until n traces are evicted,
+// so the evicted traces are the oldest of their shard but not necessarily of all the shards.
+func (s *ShardedDB) EvictTraces(ctx context.Context, serviceName string, n int, timestamp time.Time) (int64, error) {
+	var evicted int64
+	for i, db := range s.shards {
+		if evicted >= int64(n) {
+			break
+		}
+		shardEvicted, err := db.EvictTraces(ctx, serviceName, n-int(evicted), timestamp)
+		if err != nil {
+			return evicted, fmt.Errorf("shard %q: %w", s.names[i], err)
+		}
+		evicted += shardEvicted
+	}
+	return evicted, nil
+}
+
+// Rebalance moves the traces and the tombstones stored in a shard other than the one owning
+// them, after shards are added or removed from the ring, so the heartbeats of an emitted trace
+// are still recognized by the owning shard. Traces already stored in the owning shard are kept.
+// It returns the number of moved traces and tombstones.
+func (s *ShardedDB) Rebalance(ctx context.Context, batchSize int) (int64, int64, error) {
+	var moved, movedTombstones int64
+	for i := range s.shards {
+		n, err := s.rebalanceTraces(ctx, i, batchSize)
+		moved += n
+		if err != nil {
+			return moved, movedTombstones, err
+		}
+
+		n, err = s.rebalanceTombstones(ctx, i, batchSize)
+		movedTombstones += n
+		if err != nil {
+			return moved, movedTombstones, err
+		}
+	}
+	return moved, movedTombstones, nil
+}
+
+func (s *ShardedDB) rebalanceTraces(ctx context.Context, i, batchSize int) (int64, error) {
+	db := s.shards[i]
+	var moved int64
+	var after TraceKey
+	for {
+		traces, err := db.ListTracesAfter(ctx, after, batchSize)
+		if err != nil {
+			return moved, fmt.Errorf("shard %q: %w", s.names[i], err)
+		}
+
+		for _, pt := range traces {
+			owner := s.ShardIndex(pt.TraceID)
+			if owner == i {
+				continue
+			}
+
+			if err := s.shards[owner].ImportTrace(ctx, pt); err != nil {
+				return moved, fmt.Errorf("shard %q: %w", s.names[owner], err)
+			}
+			if err := db.RemoveTrace(ctx, pt.Tenant, pt.TraceID, pt.SpanID); err != nil {
+				return moved, fmt.Errorf("shard %q: %w", s.names[i], err)
+			}
+			moved++
+		}
+
+		if len(traces) < batchSize {
+			return moved, nil
+		}
+		last := traces[len(traces)-1]
+		after = TraceKey{Tenant: last.Tenant, TraceID: last.TraceID, SpanID: last.SpanID}
+	}
+}
+
+func (s *ShardedDB) rebalanceTombstones(ctx context.Context, i, batchSize int) (int64, error) {
+	db := s.shards[i]
+	var moved int64
+	var after TraceKey
+	for {
+		tombstones, err := db.ListTombstonesAfter(ctx, after, batchSize)
+		if err != nil {
+			return moved, fmt.Errorf("shard %q: %w", s.names[i], err)
+		}
+
+		for _, tombstone := range tombstones {
+			owner := s.ShardIndex(tombstone.TraceID)
+			if owner == i {
+				continue
+			}
+
+			if err := s.shards[owner].ImportTombstone(ctx, tombstone); err != nil {
+				return moved, fmt.Errorf("shard %q: %w", s.names[owner], err)
+			}
+			if err := db.RemoveTombstone(ctx, tombstone.Tenant, tombstone.TraceID, tombstone.SpanID); err != nil {
+				return moved, fmt.Errorf("shard %q: %w", s.names[i], err)
+			}
+			moved++
+		}
+
+		if len(tombstones) < batchSize {
+			return moved, nil
+		}
+		after = tombstones[len(tombstones)-1].TraceKey
+	}
+}
+
+// GetTrace returns the trace from the shard owning it, or ErrTraceNotFound if it doesn't exist.
+func (s *ShardedDB) GetTrace(ctx context.Context, tenant, traceID, spanID string) (*PartialTrace, error) {
+	return s.ForTrace(traceID).GetTrace(ctx, tenant, traceID, spanID)
+}
+
+// ExpireTrace expires the trace in the shard owning it, or returns ErrTraceNotFound if it doesn't exist.
+func (s *ShardedDB) ExpireTrace(ctx context.Context, tenant, traceID, spanID string, timestamp time.Time) error {
+	return s.ForTrace(traceID).ExpireTrace(ctx, tenant, traceID, spanID, timestamp)
+}
+
+// SetGCPaused pauses or resumes the gc of all the shards.
+func (s *ShardedDB) SetGCPaused(ctx context.Context, paused bool) error {
+	for i, db := range s.shards {
+		if err := db.SetGCPaused(ctx, paused); err != nil {
+			return fmt.Errorf("shard %q: %w", s.names[i], err)
+		}
+	}
+	return nil
+}
+
+// IsGCPaused reports whether the gc of any shard is paused, since the receivers check the gc
+// state of each shard.
+func (s *ShardedDB) IsGCPaused(ctx context.Context) (bool, error) {
+	for i, db := range s.shards {
+		paused, err := db.IsGCPaused(ctx)
+		if err != nil {
+			return false, fmt.Errorf("shard %q: %w", s.names[i], err)
+		}
+		if paused {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListTraces returns the traces of all the shards matching the filter, oldest expiration first.
+// The limit applies to the merged traces.
+func (s *ShardedDB) ListTraces(ctx context.Context, filter TraceFilter) ([]*PartialTrace, error) {
+	var traces []*PartialTrace
+	for i, db := range s.shards {
+		shardTraces, err := db.ListTraces(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("shard %q: %w", s.names[i], err)
+		}
+		traces = append(traces, shardTraces...)
+	}
+
+	slices.SortStableFunc(traces, func(a, b *PartialTrace) int {
+		return a.ExpiresAt.Compare(b.ExpiresAt)
+	})
+	if filter.Limit > 0 && len(traces) > filter.Limit {
+		traces = traces[:filter.Limit]
+	}
+	return traces, nil
+}
+
+// CountTraces sums the number of traces matching the filter in all the shards.
+func (s *ShardedDB) CountTraces(ctx context.Context, filter TraceFilter) (int64, error) {
+	return s.sum(func(db *DB) (int64, error) {
+		return db.CountTraces(ctx, filter)
+	})
+}
+
+// RemoveTraces removes the traces matching the filter from all the shards.
+func (s *ShardedDB) RemoveTraces(ctx context.Context, filter TraceFilter) (int64, error) {
+	return s.sum(func(db *DB) (int64, error) {
+		return db.RemoveTraces(ctx, filter)
+	})
+}
+
+// RequeueDeadLetteredTraces requeues the dead-lettered traces matching the filter in all the shards.
+func (s *ShardedDB) RequeueDeadLetteredTraces(ctx context.Context, filter TraceFilter, timestamp time.Time) (int64, error) {
+	return s.sum(func(db *DB) (int64, error) {
+		return db.RequeueDeadLetteredTraces(ctx, filter, timestamp)
+	})
+}
+
+// sum runs f on every shard in turn and sums the results. It stops at the first error,
+// returning the sum of the shards done so far.
+func (s *ShardedDB) sum(f func(db *DB) (int64, error)) (int64, error) {
+	var total int64
+	for i, db := range s.shards {
+		n, err := f(db)
+		if err != nil {
+			return total, fmt.Errorf("shard %q: %w", s.names[i], err)
+		}
+		total += n
+	}
+	return total, nil
+}
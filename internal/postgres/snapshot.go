@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ClaimSnapshotTraces claims up to limit traces not expired at the timestamp nor dead-lettered, and
+// not claimed during the interval before it. The claims are recorded with the timestamp apart from the
+// traces, so concurrent receivers claim different traces, each trace is claimed at most once per interval,
+// and the claims don't conflict with the gc transactions reading the traces.
+func (db *DB) ClaimSnapshotTraces(ctx context.Context, timestamp time.Time, interval time.Duration, limit int) ([]*PartialTrace, error) {
+	q := `
+WITH claimable AS (
+	SELECT t.tenant, t.trace_id, t.span_id FROM partial_traces t
+	LEFT JOIN partial_trace_snapshots s ON s.tenant = t.tenant AND s.span_id = t.span_id AND s.trace_id = t.trace_id
+	WHERE t.expires_at >= $1 AND t.dead_lettered_at IS NULL AND (s.last_snapshot_at IS NULL OR s.last_snapshot_at <= $1 - $2::interval)
+	ORDER BY s.last_snapshot_at NULLS FIRST
+	LIMIT $3
+), claimed AS (
+	INSERT INTO partial_trace_snapshots
+	(tenant, trace_id, span_id, last_snapshot_at)
+	SELECT tenant, trace_id, span_id, $1 FROM claimable
+	ON CONFLICT (tenant, span_id, trace_id) DO UPDATE
+	SET last_snapshot_at = EXCLUDED.last_snapshot_at
+	WHERE partial_trace_snapshots.last_snapshot_at <= EXCLUDED.last_snapshot_at - $2::interval
+	RETURNING tenant, trace_id, span_id
+)
+SELECT t.tenant, t.trace_id, t.span_id, t.trace, t.timestamp, t.expires_at, t.heartbeat_interval
+FROM partial_traces t
+JOIN claimed c ON c.tenant = t.tenant AND c.span_id = t.span_id AND c.trace_id = t.trace_id
+	`
+
+	rows, err := db.Query(ctx, q, timestamp, interval, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim traces: %w", err)
+	}
+	defer rows.Close()
+
+	var traces []*PartialTrace
+	for rows.Next() {
+		var trace PartialTrace
+		if err := rows.Scan(
+			&trace.Tenant,
+			&trace.TraceID,
+			&trace.SpanID,
+			&trace.Trace,
+			&trace.Timestamp,
+			&trace.ExpiresAt,
+			&trace.HeartbeatInterval,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		traces = append(traces, &trace)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	return traces, nil
+}
+
+// ReleaseSnapshotTrace releases the claim of the trace made at the timestamp, so it is claimed
+// again by the next snapshot. The claims made by other snapshots since are kept.
+func (db *DB) ReleaseSnapshotTrace(ctx context.Context, tenant, traceID, spanID string, timestamp time.Time) error {
+	q := `
+DELETE FROM partial_trace_snapshots
+WHERE trace_id = $1 AND span_id = $2 AND tenant = $3 AND last_snapshot_at = $4
+	`
+
+	if _, err := db.Exec(ctx, q, traceID, spanID, tenant, timestamp); err != nil {
+		return fmt.Errorf("failed to release snapshot claim: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveExpiredSnapshotClaims removes the claims made before the interval preceding the timestamp,
+// which no longer hold the traces back, including the claims of the traces removed since. It returns
+// the number of removed claims.
+func (db *DB) RemoveExpiredSnapshotClaims(ctx context.Context, timestamp time.Time, interval time.Duration) (int64, error) {
+	q := `
+DELETE FROM partial_trace_snapshots
+WHERE last_snapshot_at <= $1 - $2::interval
+	`
+
+	tag, err := db.Exec(ctx, q, timestamp, interval)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired snapshot claims: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
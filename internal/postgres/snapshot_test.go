@@ -0,0 +1,79 @@
+package postgres_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gotest.tools/v3/assert"
+)
+
+func (ts *TestSuite) TestClaimSnapshotTraces() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		_, err = db.Exec(context.Background(), "DELETE FROM partial_trace_snapshots")
+		t.Logf("failed to cleanup from partial_trace_snapshots: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC()
+	for _, expiresIn := range []time.Duration{-time.Hour, time.Hour, 2 * time.Hour} {
+		pt := generatePartialTrace(t)
+		pt.Timestamp = now
+		pt.ExpiresAt = now.Add(expiresIn)
+		err := db.PutTrace(ctx, pt)
+		require.NoError(t, err)
+	}
+
+	// the trace expired an hour ago is not live
+	first, err := db.ClaimSnapshotTraces(ctx, now, time.Minute, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(first))
+	second, err := db.ClaimSnapshotTraces(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(second))
+	assert.Assert(t, first[0].SpanID != second[0].SpanID)
+	for _, pt := range append(first, second...) {
+		assert.Assert(t, !pt.ExpiresAt.Before(now))
+	}
+
+	// the claims don't change the traces
+	stored, err := db.GetTrace(ctx, first[0].Tenant, first[0].TraceID, first[0].SpanID)
+	require.NoError(t, err)
+	assert.Assert(t, stored.ExpiresAt.Equal(first[0].ExpiresAt))
+
+	// a released trace is claimed again before the interval
+	err = db.ReleaseSnapshotTrace(ctx, first[0].Tenant, first[0].TraceID, first[0].SpanID, now)
+	require.NoError(t, err)
+	got, err := db.ClaimSnapshotTraces(ctx, now.Add(30*time.Second), time.Minute, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, first[0].SpanID, got[0].SpanID)
+
+	// the release of an older claim keeps the newer one
+	err = db.ReleaseSnapshotTrace(ctx, first[0].Tenant, first[0].TraceID, first[0].SpanID, now)
+	require.NoError(t, err)
+	got, err = db.ClaimSnapshotTraces(ctx, now.Add(30*time.Second), time.Minute, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(got))
+
+	// the claimed traces are claimed again after the interval
+	got, err = db.ClaimSnapshotTraces(ctx, now.Add(time.Minute), time.Minute, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, second[0].SpanID, got[0].SpanID)
+
+	// only the claims made before the interval are removed
+	removed, err := db.RemoveExpiredSnapshotClaims(ctx, now.Add(90*time.Second), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+	got, err = db.ClaimSnapshotTraces(ctx, now.Add(90*time.Second), time.Minute, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, first[0].SpanID, got[0].SpanID)
+}
@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SpanHistogram is a histogram of partial spans sharing the service and span name.
+type SpanHistogram struct {
+	ServiceName string
+	SpanName    string
+	Count       uint64
+	// Sum of the observed values in seconds
+	Sum float64
+	// BucketCounts contains len(bounds)+1 buckets, where bucket i counts the values
+	// in (bounds[i-1], bounds[i]], as the OpenTelemetry explicit bucket histograms
+	BucketCounts []uint64
+}
+
+// ListAgeHistograms returns histograms of the time elapsed since the span start, in seconds.
+// Spans without a start time are measured from their last heartbeat.
+func (db *DB) ListAgeHistograms(ctx context.Context, now time.Time, bounds []float64) ([]*SpanHistogram, error) {
+	return db.listHistograms(ctx, "extract(epoch FROM $1 - COALESCE(start_time, timestamp))", now, bounds)
+}
+
+// ListExpiryHistograms returns histograms of the time left until the span expires, in seconds.
+func (db *DB) ListExpiryHistograms(ctx context.Context, now time.Time, bounds []float64) ([]*SpanHistogram, error) {
+	return db.listHistograms(ctx, "extract(epoch FROM expires_at - $1)", now, bounds)
+}
+
+// listHistograms lists the histograms of the value over the live spans, excluding
+// the dead-lettered and evicted ones.
+func (db *DB) listHistograms(ctx context.Context, value string, now time.Time, bounds []float64) ([]*SpanHistogram, error) {
+	// width_bucket puts the values equal to a bound in the upper bucket, so the
+	// buckets are counted from the bounds lower than the value instead
+	q := fmt.Sprintf(`
+SELECT service_name, span_name, (SELECT COUNT(*) FROM unnest($2::float8[]) AS b WHERE b < v)::int AS bucket, COUNT(*), SUM(v)
+FROM (
+	SELECT service_name, span_name, %s::float8 AS v FROM partial_traces
+	WHERE dead_lettered_at IS NULL AND NOT evicted
+) AS t
+GROUP BY service_name, span_name, bucket
+ORDER BY service_name, span_name, bucket
+	`, value)
+
+	rows, err := db.Query(ctx, q, now, bounds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query histograms: %w", err)
+	}
+	defer rows.Close()
+
+	var histograms []*SpanHistogram
+	var current *SpanHistogram
+	for rows.Next() {
+		var serviceName, spanName string
+		var bucket int
+		var count uint64
+		var sum float64
+		if err := rows.Scan(&serviceName, &spanName, &bucket, &count, &sum); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		if current == nil || current.ServiceName != serviceName || current.SpanName != spanName {
+			current = &SpanHistogram{
+				ServiceName:  serviceName,
+				SpanName:     spanName,
+				BucketCounts: make([]uint64, len(bounds)+1),
+			}
+			histograms = append(histograms, current)
+		}
+
+		current.Count += count
+		current.Sum += sum
+		current.BucketCounts[bucket] += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	return histograms, nil
+}
+
+// MergeSpanHistograms merges the histograms sharing the service and span name, like the
+// histograms listed from several shards. The histograms must share the bucket bounds.
+func MergeSpanHistograms(histograms []*SpanHistogram) []*SpanHistogram {
+	type key struct {
+		serviceName string
+		spanName    string
+	}
+
+	var merged []*SpanHistogram
+	byKey := make(map[key]*SpanHistogram, len(histograms))
+	for _, h := range histograms {
+		k := key{serviceName: h.ServiceName, spanName: h.SpanName}
+		m, ok := byKey[k]
+		if !ok {
+			m = &SpanHistogram{
+				ServiceName:  h.ServiceName,
+				SpanName:     h.SpanName,
+				BucketCounts: make([]uint64, len(h.BucketCounts)),
+			}
+			byKey[k] = m
+			merged = append(merged, m)
+		}
+
+		m.Count += h.Count
+		m.Sum += h.Sum
+		for i, c := range h.BucketCounts {
+			m.BucketCounts[i] += c
+		}
+	}
+	return merged
+}
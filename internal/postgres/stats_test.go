@@ -0,0 +1,89 @@
+package postgres_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"github.com/stretchr/testify/require"
+	"gotest.tools/v3/assert"
+)
+
+func (ts *TestSuite) TestListHistograms() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC()
+	for _, age := range []time.Duration{30 * time.Second, 5 * time.Minute, 2 * time.Hour} {
+		pt := generatePartialTrace(t)
+		pt.ServiceName = "checkout"
+		pt.SpanName = "process-order"
+		pt.StartTime = now.Add(-age)
+		pt.Timestamp = now
+		pt.ExpiresAt = now.Add(age)
+		err := db.PutTrace(ctx, pt)
+		require.NoError(t, err)
+	}
+
+	bounds := []float64{60, 3600}
+
+	ages, err := db.ListAgeHistograms(ctx, now, bounds)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(ages))
+	assert.Equal(t, "checkout", ages[0].ServiceName)
+	assert.Equal(t, "process-order", ages[0].SpanName)
+	assert.Equal(t, uint64(3), ages[0].Count)
+	assert.DeepEqual(t, []uint64{1, 1, 1}, ages[0].BucketCounts)
+
+	expiries, err := db.ListExpiryHistograms(ctx, now, bounds)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(expiries))
+	assert.DeepEqual(t, []uint64{1, 1, 1}, expiries[0].BucketCounts)
+}
+
+func (ts *TestSuite) TestListHistogramsBoundsAndLiveSpans() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var pts []*postgres.PartialTrace
+	// the ages are exactly on the bounds
+	for _, age := range []time.Duration{time.Minute, time.Hour, time.Hour, time.Hour} {
+		pt := generatePartialTrace(t)
+		pt.ServiceName = "checkout"
+		pt.SpanName = "process-order"
+		pt.StartTime = now.Add(-age)
+		pt.Timestamp = now
+		pt.ExpiresAt = now.Add(time.Hour)
+		err := db.PutTrace(ctx, pt)
+		require.NoError(t, err)
+		pts = append(pts, pt)
+	}
+
+	// dead-lettered and evicted spans are not live
+	err := db.DeadLetterTrace(ctx, pts[2].Tenant, pts[2].TraceID, pts[2].SpanID, "permanent error")
+	require.NoError(t, err)
+	_, err = db.Exec(ctx, "UPDATE partial_traces SET evicted = true WHERE trace_id = $1", pts[3].TraceID)
+	require.NoError(t, err)
+
+	ages, err := db.ListAgeHistograms(ctx, now, []float64{60, 3600})
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(ages))
+	assert.Equal(t, uint64(2), ages[0].Count)
+	// the bounds are upper-inclusive
+	assert.DeepEqual(t, []uint64{1, 1, 0}, ages[0].BucketCounts)
+}
@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Tombstone records the last emission of a trace by the gc.
+type Tombstone struct {
+	// TraceKey identifies the trace, it is only set by ListTombstonesAfter
+	TraceKey
+	// Reason is the reason the trace was emitted for
+	Reason string
+	// CreatedAt is the time the trace was emitted
+	CreatedAt time.Time
+	// ExpiresAt is the time the tombstone expires, it is only set by ListTombstonesAfter
+	ExpiresAt time.Time
+}
+
+// PutTombstone records that the trace has been emitted for the reason, so the heartbeats
+// received for it until the tombstone expires are recognized instead of storing it as a new trace.
+func (db *DB) PutTombstone(ctx context.Context, tenant, traceID, spanID, reason string, expiresAt time.Time) error {
+	q := `
+INSERT INTO partial_trace_tombstones
+(tenant, trace_id, span_id, reason, expires_at)
+VALUES
+($1, $2, $3, $4, $5)
+ON CONFLICT (tenant, span_id, trace_id) DO UPDATE
+SET reason = $4, created_at = now(), expires_at = GREATEST(partial_trace_tombstones.expires_at, $5)
+	`
+
+	if _, err := db.Exec(ctx, q, tenant, traceID, spanID, reason, expiresAt); err != nil {
+		return fmt.Errorf("failed to insert tombstone: %w", err)
+	}
+
+	return nil
+}
+
+// TouchTombstone extends the tombstone of the trace to expire no earlier than expiresAt, or than
+// expiresAfter from the clock of the database when it is set, so it outlives the heartbeats still
+// received for the trace. It returns the tombstone, or nil if the trace has none.
+func (db *DB) TouchTombstone(ctx context.Context, tenant, traceID, spanID string, expiresAt time.Time, expiresAfter time.Duration) (*Tombstone, error) {
+	q := `
+UPDATE partial_trace_tombstones
+SET expires_at = GREATEST(expires_at, COALESCE(now() + $5::interval, $4))
+WHERE trace_id = $1 AND span_id = $2 AND tenant = $3
+RETURNING reason, created_at
+	`
+
+	var tombstone Tombstone
+	if err := db.QueryRow(ctx, q, traceID, spanID, tenant, expiresAt, nullDuration(expiresAfter)).Scan(
+		&tombstone.Reason,
+		&tombstone.CreatedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to touch tombstone: %w", err)
+	}
+
+	return &tombstone, nil
+}
+
+// RemoveTombstone removes the tombstone of the trace.
+func (db *DB) RemoveTombstone(ctx context.Context, tenant, traceID, spanID string) error {
+	q := `
+DELETE FROM partial_trace_tombstones
+WHERE trace_id = $1 AND span_id = $2 AND tenant = $3
+	`
+
+	if _, err := db.Exec(ctx, q, traceID, spanID, tenant); err != nil {
+		return fmt.Errorf("failed to delete tombstone: %w", err)
+	}
+
+	return nil
+}
+
+// ListTombstonesAfter returns up to limit tombstones, with all their fields, ordered by key after the given key.
+func (db *DB) ListTombstonesAfter(ctx context.Context, after TraceKey, limit int) ([]*Tombstone, error) {
+	q := `
+SELECT tenant, trace_id, span_id, reason, created_at, expires_at
+FROM partial_trace_tombstones
+WHERE (tenant, span_id, trace_id) > ($1, $2, $3)
+ORDER BY tenant, span_id, trace_id
+LIMIT $4
+	`
+
+	rows, err := db.Query(ctx, q, after.Tenant, after.SpanID, after.TraceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tombstones: %w", err)
+	}
+	defer rows.Close()
+
+	var tombstones []*Tombstone
+	for rows.Next() {
+		var tombstone Tombstone
+		if err := rows.Scan(
+			&tombstone.Tenant,
+			&tombstone.TraceID,
+			&tombstone.SpanID,
+			&tombstone.Reason,
+			&tombstone.CreatedAt,
+			&tombstone.ExpiresAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		tombstones = append(tombstones, &tombstone)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	return tombstones, nil
+}
+
+// ImportTombstone stores the tombstone with all its fields, as listed by ListTombstonesAfter.
+// A tombstone already stored keeps the reason of the latest emission and the latest expiration.
+func (db *DB) ImportTombstone(ctx context.Context, tombstone *Tombstone) error {
+	q := `
+INSERT INTO partial_trace_tombstones
+(tenant, trace_id, span_id, reason, created_at, expires_at)
+VALUES
+($1, $2, $3, $4, $5, $6)
+ON CONFLICT (tenant, span_id, trace_id) DO UPDATE
+SET reason = CASE WHEN EXCLUDED.created_at > partial_trace_tombstones.created_at
+		THEN EXCLUDED.reason ELSE partial_trace_tombstones.reason END,
+	created_at = GREATEST(partial_trace_tombstones.created_at, EXCLUDED.created_at),
+	expires_at = GREATEST(partial_trace_tombstones.expires_at, EXCLUDED.expires_at)
+	`
+
+	if _, err := db.Exec(
+		ctx,
+		q,
+		tombstone.Tenant,
+		tombstone.TraceID,
+		tombstone.SpanID,
+		tombstone.Reason,
+		tombstone.CreatedAt,
+		tombstone.ExpiresAt,
+	); err != nil {
+		return fmt.Errorf("failed to import tombstone: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveExpiredTombstones removes the tombstones expired before the timestamp and
+// returns the number of removed tombstones.
+func (db *DB) RemoveExpiredTombstones(ctx context.Context, timestamp time.Time) (int64, error) {
+	q := `
+DELETE FROM partial_trace_tombstones
+WHERE expires_at < $1
+	`
+
+	tag, err := db.Exec(ctx, q, timestamp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired tombstones: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
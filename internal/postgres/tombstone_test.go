@@ -0,0 +1,152 @@
+package postgres_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gotest.tools/v3/assert"
+
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+)
+
+func (ts *TestSuite) TestTombstone() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_trace_tombstones")
+		t.Logf("failed to cleanup from partial_trace_tombstones: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC()
+	pt := generatePartialTrace(t)
+
+	tombstone, err := db.TouchTombstone(ctx, pt.Tenant, pt.TraceID, pt.SpanID, now, 0)
+	require.NoError(t, err)
+	assert.Assert(t, tombstone == nil)
+
+	err = db.PutTombstone(ctx, pt.Tenant, pt.TraceID, pt.SpanID, "max_lifetime", now.Add(time.Minute))
+	require.NoError(t, err)
+
+	tombstone, err = db.TouchTombstone(ctx, pt.Tenant, pt.TraceID, pt.SpanID, now.Add(time.Hour), 0)
+	require.NoError(t, err)
+	assert.Assert(t, tombstone != nil)
+	assert.Equal(t, "max_lifetime", tombstone.Reason)
+	assert.Assert(t, !tombstone.CreatedAt.IsZero())
+
+	removed, err := db.RemoveExpiredTombstones(ctx, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), removed)
+
+	removed, err = db.RemoveExpiredTombstones(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+}
+
+func (ts *TestSuite) TestMaxLifetime() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	t.Cleanup(func() {
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_traces")
+		t.Logf("failed to cleanup from partial_traces: %v", err)
+		ts.releaseDB()
+	})
+
+	now := time.Now().UTC()
+	pt := generatePartialTrace(t)
+	pt.Timestamp = now
+	pt.ExpiresAt = now.Add(time.Hour)
+	pt.LifetimeExpiresAt = now.Add(time.Minute)
+	err := db.PutTrace(ctx, pt)
+	require.NoError(t, err)
+
+	// later heartbeats must not move the lifetime
+	pt.LifetimeExpiresAt = now.Add(2 * time.Hour)
+	err = db.PutTrace(ctx, pt)
+	require.NoError(t, err)
+
+	got, err := db.ListExpiredTraces(ctx, now.Add(2*time.Minute), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+	assert.Assert(t, got[0].ExpiresAt.Equal(got[0].LifetimeExpiresAt))
+}
+
+func (ts *TestSuite) TestRebalanceTombstones() {
+	ctx := context.Background()
+	t := ts.T()
+	db := ts.acquireDB()
+
+	shardCfg, err := ts.tp.CreateDatabase(ctx, "rebalance")
+	require.NoError(t, err)
+
+	sharded, err := postgres.NewShardedDB(ctx, []postgres.ShardConfig{
+		{Name: "shard-a", Postgres: postgres.Config{URL: ts.tp.cfg.DBConnStr()}},
+		{Name: "shard-b", Postgres: postgres.Config{URL: shardCfg.DBConnStr()}},
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = sharded.Close()
+		_, err := db.Exec(context.Background(), "DELETE FROM partial_trace_tombstones")
+		t.Logf("failed to cleanup from partial_trace_tombstones: %v", err)
+		err = ts.tp.DropDatabase(context.Background(), "rebalance")
+		t.Logf("failed to drop the rebalance database: %v", err)
+		ts.releaseDB()
+	})
+
+	// find a trace owned by each shard
+	var kept, moved *postgres.PartialTrace
+	for kept == nil || moved == nil {
+		pt := generatePartialTrace(t)
+		if sharded.ShardIndex(pt.TraceID) == 0 {
+			kept = pt
+		} else {
+			moved = pt
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for _, pt := range []*postgres.PartialTrace{kept, moved} {
+		err = db.PutTombstone(ctx, pt.Tenant, pt.TraceID, pt.SpanID, "max_lifetime", now.Add(time.Hour))
+		require.NoError(t, err)
+	}
+	tombstones, err := db.ListTombstonesAfter(ctx, postgres.TraceKey{}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(tombstones))
+	var original *postgres.Tombstone
+	for _, tombstone := range tombstones {
+		if tombstone.SpanID == moved.SpanID {
+			original = tombstone
+		}
+	}
+	assert.Assert(t, original != nil)
+
+	movedTraces, movedTombstones, err := sharded.Rebalance(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), movedTraces)
+	assert.Equal(t, int64(1), movedTombstones)
+
+	// the tombstone is moved to the owning shard with its reason, creation and expiration times
+	tombstone, err := db.TouchTombstone(ctx, moved.Tenant, moved.TraceID, moved.SpanID, now, 0)
+	require.NoError(t, err)
+	assert.Assert(t, tombstone == nil)
+
+	owner := sharded.Shards()[1]
+	tombstones, err = owner.ListTombstonesAfter(ctx, postgres.TraceKey{}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(tombstones))
+	assert.Equal(t, moved.TraceID, tombstones[0].TraceID)
+	assert.Equal(t, moved.SpanID, tombstones[0].SpanID)
+	assert.Equal(t, "max_lifetime", tombstones[0].Reason)
+	assert.Assert(t, original.CreatedAt.Equal(tombstones[0].CreatedAt))
+	assert.Assert(t, now.Add(time.Hour).Equal(tombstones[0].ExpiresAt))
+
+	tombstone, err = db.TouchTombstone(ctx, kept.Tenant, kept.TraceID, kept.SpanID, now, 0)
+	require.NoError(t, err)
+	assert.Assert(t, tombstone != nil)
+}
@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/G-Research/otel-partial-collector/internal/postgres"
+
+// queryTracer is a pgx.QueryTracer emitting a client span for each query.
+type queryTracer struct {
+	tracer trace.Tracer
+	attrs  []attribute.KeyValue
+}
+
+func (t *queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	cfg := conn.Config()
+	ctx, _ = t.tracer.Start(
+		ctx,
+		queryOperation(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.namespace", cfg.Database),
+			attribute.String("db.query.text", data.SQL),
+			attribute.String("server.address", cfg.Host),
+			attribute.Int("server.port", int(cfg.Port)),
+		),
+		trace.WithAttributes(t.attrs...),
+	)
+	return ctx
+}
+
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	// the command tag counts the returned rows of the selects and the affected rows of the writes
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	}
+	span.End()
+}
+
+// queryOperation returns the first keyword of the query, used as the name of its span.
+func queryOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "postgresql"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,18 @@
+package postgres
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestQueryOperation(t *testing.T) {
+	for sql, want := range map[string]string{
+		"SELECT 1":                           "SELECT",
+		"\n\tinsert into partial_traces ...": "INSERT",
+		"WITH expired AS (...) DELETE ...":   "WITH",
+		"":                                   "postgresql",
+	} {
+		assert.Equal(t, want, queryOperation(sql), sql)
+	}
+}
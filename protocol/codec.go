@@ -0,0 +1,192 @@
+package protocol
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+var (
+	// ErrUnsupportedVersion is returned when the partial.version attribute is not one of the SupportedVersions.
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	// ErrUnknownEvent is returned when the partial.event attribute is missing or unknown.
+	ErrUnknownEvent = errors.New("unknown event type")
+	// ErrUnknownBodyType is returned when the partial.body.type attribute is unknown, or missing from a Version2 record.
+	ErrUnknownBodyType = errors.New("unknown body type")
+	// ErrInvalidBody is returned when the body cannot be decoded as traces.
+	ErrInvalidBody = errors.New("invalid body")
+	// ErrInvalidFrequency is returned when the partial.frequency attribute of a heartbeat is missing or invalid.
+	ErrInvalidFrequency = errors.New("invalid frequency")
+)
+
+var (
+	tracesProtoMarshaler   ptrace.ProtoMarshaler
+	tracesProtoUnmarshaler ptrace.ProtoUnmarshaler
+	tracesJSONUnmarshaler  ptrace.JSONUnmarshaler
+)
+
+// Message is the content of a heartbeat or stop log record.
+type Message struct {
+	// Version is the version of the record, Version1 if unset when encoding.
+	Version Version
+	Event   EventType
+	// HeartbeatInterval is the interval between the heartbeats of the spans,
+	// only set for heartbeats.
+	HeartbeatInterval time.Duration
+	Traces            ptrace.Traces
+}
+
+// Decode decodes the heartbeat or stop log record of any of the SupportedVersions.
+// The returned errors wrap one of ErrUnsupportedVersion, ErrUnknownEvent,
+// ErrUnknownBodyType, ErrInvalidBody and ErrInvalidFrequency.
+func Decode(record plog.LogRecord) (Message, error) {
+	attrs := record.Attributes()
+	version, err := VersionFromAttributes(attrs)
+	if err != nil {
+		return Message{}, err
+	}
+
+	event, err := eventTypeFromAttributes(attrs)
+	if err != nil {
+		return Message{}, err
+	}
+
+	bodyType, err := bodyTypeFromAttributes(version, attrs)
+	if err != nil {
+		return Message{}, err
+	}
+
+	traces, err := UnmarshalBody(bodyType, record.Body().AsString())
+	if err != nil {
+		return Message{}, err
+	}
+
+	msg := Message{Version: version, Event: event, Traces: traces}
+	if event == EventTypeHeartbeat {
+		msg.HeartbeatInterval, err = heartbeatIntervalFromAttributes(version, attrs)
+		if err != nil {
+			return Message{}, err
+		}
+	}
+
+	return msg, nil
+}
+
+// Encode encodes the message into the log record with a BodyTypeProto body.
+func Encode(msg Message, record plog.LogRecord) error {
+	version := msg.Version
+	if version == 0 {
+		version = Version1
+	}
+	if !version.Supported() {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	if msg.Event != EventTypeHeartbeat && msg.Event != EventTypeStop {
+		return fmt.Errorf("%w: %v", ErrUnknownEvent, msg.Event)
+	}
+
+	body, err := MarshalBody(msg.Traces)
+	if err != nil {
+		return err
+	}
+
+	record.Body().SetStr(body)
+	attrs := record.Attributes()
+	if version != Version1 {
+		attrs.PutInt(AttributeVersion, int64(version))
+	}
+	attrs.PutStr(AttributeEvent, msg.Event.String())
+	attrs.PutStr(AttributeBodyType, string(BodyTypeProto))
+	if msg.Event == EventTypeHeartbeat {
+		switch version {
+		case Version1:
+			attrs.PutStr(AttributeFrequency, msg.HeartbeatInterval.String())
+		case Version2:
+			attrs.PutInt(AttributeFrequency, msg.HeartbeatInterval.Milliseconds())
+		}
+	}
+
+	return nil
+}
+
+// MarshalBody encodes the traces as a BodyTypeProto body.
+func MarshalBody(traces ptrace.Traces) (string, error) {
+	b, err := tracesProtoMarshaler.MarshalTraces(traces)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal traces: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// UnmarshalBody decodes the body of the given type.
+func UnmarshalBody(bodyType BodyType, body string) (ptrace.Traces, error) {
+	var b []byte
+	var unmarshaler ptrace.Unmarshaler
+	switch bodyType {
+	case BodyTypeProto:
+		rawTrace, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return ptrace.Traces{}, fmt.Errorf("%w: failed to base64 decode: %v", ErrInvalidBody, err)
+		}
+		b, unmarshaler = rawTrace, &tracesProtoUnmarshaler
+	case BodyTypeJSON:
+		b, unmarshaler = []byte(body), &tracesJSONUnmarshaler
+	default:
+		return ptrace.Traces{}, fmt.Errorf("%w: %q", ErrUnknownBodyType, bodyType)
+	}
+
+	traces, err := unmarshaler.UnmarshalTraces(b)
+	if err != nil {
+		return ptrace.Traces{}, fmt.Errorf("%w: failed to unmarshal traces: %v", ErrInvalidBody, err)
+	}
+	return traces, nil
+}
+
+func eventTypeFromAttributes(attrs pcommon.Map) (EventType, error) {
+	v, ok := attrs.Get(AttributeEvent)
+	if !ok {
+		return EventTypeUnknown, fmt.Errorf("%w: empty", ErrUnknownEvent)
+	}
+
+	event, err := ParseEventType(v.AsString())
+	if err != nil {
+		return EventTypeUnknown, fmt.Errorf("%w: %q", ErrUnknownEvent, v.AsString())
+	}
+	return event, nil
+}
+
+func bodyTypeFromAttributes(version Version, attrs pcommon.Map) (BodyType, error) {
+	v, ok := attrs.Get(AttributeBodyType)
+	if ok {
+		return BodyType(v.AsString()), nil
+	}
+	if version == Version1 {
+		return BodyTypeProto, nil
+	}
+	return "", fmt.Errorf("%w: body type is not set", ErrUnknownBodyType)
+}
+
+func heartbeatIntervalFromAttributes(version Version, attrs pcommon.Map) (time.Duration, error) {
+	freq, ok := attrs.Get(AttributeFrequency)
+	if !ok {
+		return 0, fmt.Errorf("%w: frequency is not set", ErrInvalidFrequency)
+	}
+
+	if version == Version1 {
+		d, err := time.ParseDuration(freq.AsString())
+		if err != nil {
+			return 0, fmt.Errorf("%w: failed to parse duration: %v", ErrInvalidFrequency, err)
+		}
+		return d, nil
+	}
+
+	if freq.Type() != pcommon.ValueTypeInt || freq.Int() <= 0 {
+		return 0, fmt.Errorf("%w: expected a positive number of milliseconds, got %q", ErrInvalidFrequency, freq.AsString())
+	}
+	return time.Duration(freq.Int()) * time.Millisecond, nil
+}
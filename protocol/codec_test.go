@@ -0,0 +1,197 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func testTraces() ptrace.Traces {
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "checkout")
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetTraceID(pcommon.TraceID{1, 2, 3})
+	span.SetSpanID(pcommon.SpanID{4, 5, 6})
+	span.SetName("process order")
+	return traces
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, msg := range []Message{
+		{Version: Version1, Event: EventTypeHeartbeat, HeartbeatInterval: 10 * time.Second, Traces: testTraces()},
+		{Version: Version1, Event: EventTypeStop, Traces: testTraces()},
+		{Version: Version2, Event: EventTypeHeartbeat, HeartbeatInterval: 1500 * time.Millisecond, Traces: testTraces()},
+		{Version: Version2, Event: EventTypeStop, Traces: testTraces()},
+	} {
+		t.Run("v"+msg.Version.String()+" "+msg.Event.String(), func(t *testing.T) {
+			record := plog.NewLogRecord()
+			require.NoError(t, Encode(msg, record))
+
+			event, ok := record.Attributes().Get(AttributeEvent)
+			require.True(t, ok)
+			assert.Equal(t, msg.Event.String(), event.Str())
+
+			got, err := Decode(record)
+			require.NoError(t, err)
+			assert.Equal(t, msg, got)
+		})
+	}
+
+	// records are encoded in the first version unless asked otherwise,
+	// so they are understood by exporters predating the versions
+	record := plog.NewLogRecord()
+	require.NoError(t, Encode(Message{Event: EventTypeHeartbeat, HeartbeatInterval: time.Second, Traces: testTraces()}, record))
+	_, ok := record.Attributes().Get(AttributeVersion)
+	assert.False(t, ok)
+	frequency, ok := record.Attributes().Get(AttributeFrequency)
+	require.True(t, ok)
+	assert.Equal(t, "1s", frequency.Str())
+
+	assert.ErrorIs(t, Encode(Message{Traces: testTraces()}, plog.NewLogRecord()), ErrUnknownEvent)
+	assert.ErrorIs(t, Encode(Message{Version: 3, Event: EventTypeStop, Traces: testTraces()}, plog.NewLogRecord()), ErrUnsupportedVersion)
+}
+
+func TestDecode(t *testing.T) {
+	body, err := MarshalBody(testTraces())
+	require.NoError(t, err)
+	var jsonMarshaler ptrace.JSONMarshaler
+	jsonBody, err := jsonMarshaler.MarshalTraces(testTraces())
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name         string
+		attrs        map[string]any
+		body         string
+		wantVersion  Version
+		wantInterval time.Duration
+		wantErr      error
+	}{
+		{
+			name:         "default body type",
+			attrs:        map[string]any{"partial.event": "heartbeat", "partial.frequency": "5s"},
+			body:         body,
+			wantVersion:  Version1,
+			wantInterval: 5 * time.Second,
+		},
+		{
+			name:        "json body",
+			attrs:       map[string]any{"partial.event": "stop", "partial.body.type": "json/v1"},
+			body:        string(jsonBody),
+			wantVersion: Version1,
+		},
+		{
+			name:         "explicit version 1",
+			attrs:        map[string]any{"partial.version": "1", "partial.event": "heartbeat", "partial.frequency": "1m"},
+			body:         body,
+			wantVersion:  Version1,
+			wantInterval: time.Minute,
+		},
+		{
+			name:         "version 2",
+			attrs:        map[string]any{"partial.version": 2, "partial.event": "heartbeat", "partial.body.type": "proto", "partial.frequency": 250},
+			body:         body,
+			wantVersion:  Version2,
+			wantInterval: 250 * time.Millisecond,
+		},
+		{
+			name:    "version 2 without body type",
+			attrs:   map[string]any{"partial.version": 2, "partial.event": "stop"},
+			body:    body,
+			wantErr: ErrUnknownBodyType,
+		},
+		{
+			name:    "version 2 with a duration frequency",
+			attrs:   map[string]any{"partial.version": 2, "partial.event": "heartbeat", "partial.body.type": "proto", "partial.frequency": "5s"},
+			body:    body,
+			wantErr: ErrInvalidFrequency,
+		},
+		{
+			name:    "unsupported version",
+			attrs:   map[string]any{"partial.version": 3, "partial.event": "stop"},
+			body:    body,
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "invalid version",
+			attrs:   map[string]any{"partial.version": "latest", "partial.event": "stop"},
+			body:    body,
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "missing event",
+			attrs:   map[string]any{"partial.frequency": "5s"},
+			body:    body,
+			wantErr: ErrUnknownEvent,
+		},
+		{
+			name:    "unknown event",
+			attrs:   map[string]any{"partial.event": "start"},
+			body:    body,
+			wantErr: ErrUnknownEvent,
+		},
+		{
+			name:    "unknown body type",
+			attrs:   map[string]any{"partial.event": "stop", "partial.body.type": "avro"},
+			body:    body,
+			wantErr: ErrUnknownBodyType,
+		},
+		{
+			name:    "invalid base64 body",
+			attrs:   map[string]any{"partial.event": "stop"},
+			body:    "not base64",
+			wantErr: ErrInvalidBody,
+		},
+		{
+			name:    "invalid json body",
+			attrs:   map[string]any{"partial.event": "stop", "partial.body.type": "json/v1"},
+			body:    "{",
+			wantErr: ErrInvalidBody,
+		},
+		{
+			name:    "missing frequency",
+			attrs:   map[string]any{"partial.event": "heartbeat"},
+			body:    body,
+			wantErr: ErrInvalidFrequency,
+		},
+		{
+			name:    "invalid frequency",
+			attrs:   map[string]any{"partial.event": "heartbeat", "partial.frequency": "often"},
+			body:    body,
+			wantErr: ErrInvalidFrequency,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			record := plog.NewLogRecord()
+			require.NoError(t, record.Attributes().FromRaw(tt.attrs))
+			record.Body().SetStr(tt.body)
+
+			msg, err := Decode(record)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantVersion, msg.Version)
+			assert.Equal(t, tt.wantInterval, msg.HeartbeatInterval)
+			assert.Equal(t, testTraces(), msg.Traces)
+		})
+	}
+}
+
+func TestParseEventType(t *testing.T) {
+	for _, event := range []EventType{EventTypeHeartbeat, EventTypeStop} {
+		got, err := ParseEventType(event.String())
+		require.NoError(t, err)
+		assert.Equal(t, event, got)
+	}
+
+	_, err := ParseEventType(EventTypeUnknown.String())
+	assert.Error(t, err)
+}
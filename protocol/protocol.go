@@ -0,0 +1,129 @@
+// Package protocol defines the wire format of the heartbeat and stop log
+// records sent by the producers of partial spans and parsed by the
+// otelpartialexporter.
+//
+// A record carries its spans in the body, encoded as described by the
+// partial.body.type attribute, and the partial.event attribute telling whether
+// the spans are still in flight (heartbeat) or ended (stop). Heartbeats also
+// carry the partial.frequency attribute, the interval between two heartbeats
+// of the spans.
+//
+// The format is versioned by the partial.version attribute, so it can evolve
+// without breaking the producers of older versions. Records without the
+// attribute are Version1 records.
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// Attribute keys of the heartbeat and stop log records.
+const (
+	// AttributePrefix prefixes the attributes of the protocol, which are not
+	// copied from the log record to its spans.
+	AttributePrefix = "partial."
+
+	AttributeVersion   = "partial.version"
+	AttributeEvent     = "partial.event"
+	AttributeFrequency = "partial.frequency"
+	AttributeBodyType  = "partial.body.type"
+)
+
+// Version is the value of the partial.version attribute.
+type Version int
+
+const (
+	// Version1 is the original format. The partial.body.type attribute is
+	// optional and partial.frequency is a Go duration string.
+	Version1 Version = 1
+	// Version2 requires the partial.body.type attribute and carries
+	// partial.frequency as an integer number of milliseconds, which producers
+	// outside of Go can write without formatting a Go duration.
+	Version2 Version = 2
+)
+
+// SupportedVersions are the versions this package can encode and decode.
+var SupportedVersions = []Version{Version1, Version2}
+
+// Supported reports whether the version is one of the SupportedVersions.
+func (v Version) Supported() bool {
+	return v == Version1 || v == Version2
+}
+
+func (v Version) String() string {
+	return strconv.Itoa(int(v))
+}
+
+// VersionFromAttributes returns the version of the record with the attributes.
+// The returned error wraps ErrUnsupportedVersion.
+func VersionFromAttributes(attrs pcommon.Map) (Version, error) {
+	v, ok := attrs.Get(AttributeVersion)
+	if !ok {
+		return Version1, nil
+	}
+
+	var version Version
+	switch v.Type() {
+	case pcommon.ValueTypeInt:
+		version = Version(v.Int())
+	case pcommon.ValueTypeStr:
+		i, err := strconv.Atoi(v.Str())
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrUnsupportedVersion, v.Str())
+		}
+		version = Version(i)
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedVersion, v.AsString())
+	}
+
+	if !version.Supported() {
+		return 0, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	return version, nil
+}
+
+// EventType is the value of the partial.event attribute.
+type EventType int
+
+const (
+	EventTypeUnknown EventType = iota
+	EventTypeHeartbeat
+	EventTypeStop
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventTypeHeartbeat:
+		return "heartbeat"
+	case EventTypeStop:
+		return "stop"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseEventType parses the value of the partial.event attribute.
+func ParseEventType(s string) (EventType, error) {
+	switch s {
+	case "heartbeat":
+		return EventTypeHeartbeat, nil
+	case "stop":
+		return EventTypeStop, nil
+	default:
+		return EventTypeUnknown, fmt.Errorf("unknown event type: %q", s)
+	}
+}
+
+// BodyType is the value of the partial.body.type attribute. Records without
+// the attribute have a BodyTypeProto body.
+type BodyType string
+
+const (
+	// BodyTypeProto is a base64 encoded OTLP protobuf traces message.
+	BodyTypeProto BodyType = "proto"
+	// BodyTypeJSON is an OTLP JSON traces message.
+	BodyTypeJSON BodyType = "json/v1"
+)
@@ -1,26 +1,172 @@
 package otelpartialreceiver
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"go.opentelemetry.io/collector/component"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
 )
 
 type Config struct {
-	Postgres   string `mapstructure:"postgres"`
-	GCInterval string `mapstructure:"gc_interval"`
+	// Postgres configures the connection to the postgres instance, as a URL or as structured settings.
+	Postgres postgres.Config `mapstructure:"postgres"`
+	// Shards are the postgres instances the partial spans are spread between
+	// by the exporter, used instead of the single Postgres instance.
+	Shards     []postgres.ShardConfig `mapstructure:"shards"`
+	GCInterval string                 `mapstructure:"gc_interval"`
+	// Completion configures how garbage collected spans are completed
+	// before they are sent through the pipeline.
+	Completion partial.CompletionConfig `mapstructure:"completion"`
+	// Metrics configures the metrics about partial spans reported when
+	// the receiver is used in a metrics pipeline.
+	Metrics MetricsConfig `mapstructure:"metrics"`
+	// RateLimit limits the rate at which collected spans are emitted.
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	// ShutdownDrainTimeout is the time given to the in-flight batch to complete
+	// on shutdown before it is aborted.
+	ShutdownDrainTimeout string `mapstructure:"shutdown_drain_timeout"`
+	// Tenant configures how the tenant stored with a partial span is attached to the emitted data.
+	Tenant TenantConfig `mapstructure:"tenant"`
+	// TombstoneRetention is the minimum time the ids of spans emitted at the end of their
+	// max lifetime are kept, so the heartbeats still received for them are ignored.
+	TombstoneRetention string `mapstructure:"tombstone_retention"`
+	// ResurrectionRetention is the minimum time the ids of the other emitted spans are kept, so the
+	// spans heartbeating again are emitted marked as resurrected. Zero disables it.
+	ResurrectionRetention string `mapstructure:"resurrection_retention"`
+	// Clock selects the clock the expiration times are compared with: "local" or "database".
+	Clock partial.Clock `mapstructure:"clock"`
+	// Snapshot configures the periodic emission of the live spans when the receiver
+	// is used in a traces pipeline.
+	Snapshot SnapshotConfig `mapstructure:"snapshot"`
+}
+
+// TenantConfig defines how the tenant of a partial span is passed downstream.
+// Nothing is attached to partial spans without a tenant.
+type TenantConfig struct {
+	// MetadataKey is the client metadata key set to the tenant in the context of the
+	// emitted data, e.g. X-Scope-OrgID. Exporters can forward it with the headers_setter extension.
+	MetadataKey string `mapstructure:"metadata_key"`
+	// ResourceAttribute is the resource attribute set to the tenant when the emitted
+	// span doesn't have it already.
+	ResourceAttribute string `mapstructure:"resource_attribute"`
+}
+
+// MetricsConfig defines how the metrics about partial spans are computed.
+type MetricsConfig struct {
+	// Interval is the interval at which the metrics are computed from the database.
+	Interval string `mapstructure:"interval"`
+	// AgeBuckets are the histogram bucket boundaries of the span age, in seconds.
+	AgeBuckets []float64 `mapstructure:"age_buckets"`
+	// ExpiryBuckets are the histogram bucket boundaries of the time until the span expires, in seconds.
+	ExpiryBuckets []float64 `mapstructure:"expiry_buckets"`
+}
+
+// RateLimitConfig defines the limits applied to the emission of collected or snapshot spans.
+// Spans over the limit are left in the database for later cycles.
+type RateLimitConfig struct {
+	// SpansPerSecond limits the number of emitted spans per second. Zero disables the limit.
+	SpansPerSecond float64 `mapstructure:"spans_per_second"`
+	// BatchesPerSecond limits the number of processed batches per second. Zero disables the limit.
+	BatchesPerSecond float64 `mapstructure:"batches_per_second"`
+	// BatchSize is the maximum number of spans processed in a single batch. Zero disables the limit.
+	BatchSize int `mapstructure:"batch_size"`
 }
 
 func (c *Config) Validate() error {
+	if _, err := postgres.ResolveShards(c.Postgres, c.Shards); err != nil {
+		return err
+	}
+
 	if _, err := time.ParseDuration(c.GCInterval); err != nil {
 		return fmt.Errorf("failed to parse interval duration: %w", err)
 	}
+
+	if _, err := time.ParseDuration(c.Metrics.Interval); err != nil {
+		return fmt.Errorf("failed to parse metrics interval duration: %w", err)
+	}
+
+	if !isStrictlyIncreasing(c.Metrics.AgeBuckets) {
+		return errors.New("age buckets must be strictly increasing")
+	}
+
+	if !isStrictlyIncreasing(c.Metrics.ExpiryBuckets) {
+		return errors.New("expiry buckets must be strictly increasing")
+	}
+
+	drainTimeout, err := time.ParseDuration(c.ShutdownDrainTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to parse shutdown drain timeout: %w", err)
+	}
+
+	if drainTimeout < 0 {
+		return errors.New("shutdown drain timeout cannot be negative")
+	}
+
+	tombstoneRetention, err := time.ParseDuration(c.TombstoneRetention)
+	if err != nil {
+		return fmt.Errorf("failed to parse tombstone retention: %w", err)
+	}
+
+	if tombstoneRetention < 0 {
+		return errors.New("tombstone retention cannot be negative")
+	}
+
+	resurrectionRetention, err := time.ParseDuration(c.ResurrectionRetention)
+	if err != nil {
+		return fmt.Errorf("failed to parse resurrection retention: %w", err)
+	}
+
+	if resurrectionRetention < 0 {
+		return errors.New("resurrection retention cannot be negative")
+	}
+
+	return nil
+}
+
+func (c *RateLimitConfig) Validate() error {
+	if c.SpansPerSecond < 0 {
+		return errors.New("spans per second cannot be negative")
+	}
+
+	if c.BatchesPerSecond < 0 {
+		return errors.New("batches per second cannot be negative")
+	}
+
+	if c.BatchSize < 0 {
+		return errors.New("batch size cannot be negative")
+	}
+
 	return nil
 }
 
+func isStrictlyIncreasing(bounds []float64) bool {
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
 func createDefaultConfig() component.Config {
 	return &Config{
-		GCInterval: "5s",
+		GCInterval:            "5s",
+		Completion:            partial.DefaultCompletionConfig(),
+		ShutdownDrainTimeout:  "10s",
+		TombstoneRetention:    "1h",
+		ResurrectionRetention: "0s",
+		Clock:                 partial.ClockLocal,
+		Snapshot: SnapshotConfig{
+			Interval: "0s",
+		},
+		Metrics: MetricsConfig{
+			Interval:      "30s",
+			AgeBuckets:    []float64{60, 300, 900, 1800, 3600, 7200, 21600, 43200, 86400},
+			ExpiryBuckets: []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800},
+		},
 	}
 }
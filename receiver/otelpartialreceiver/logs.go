@@ -0,0 +1,48 @@
+package otelpartialreceiver
+
+import (
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+)
+
+// abandonmentLogs creates the log record describing the collected span.
+// The record carries the resource of the span, so service.name is preserved.
+func abandonmentLogs(trace ptrace.Traces, pt *postgres.PartialTrace, reason partial.GCReason, now time.Time) plog.Logs {
+	resourceSpan := trace.ResourceSpans().At(0)
+	span := resourceSpan.ScopeSpans().At(0).Spans().At(0)
+
+	logs := plog.NewLogs()
+	resourceLog := logs.ResourceLogs().AppendEmpty()
+	resourceSpan.Resource().CopyTo(resourceLog.Resource())
+	resourceLog.SetSchemaUrl(resourceSpan.SchemaUrl())
+
+	scopeLog := resourceLog.ScopeLogs().AppendEmpty()
+	scopeLog.Scope().SetName(typeStr.String())
+
+	record := scopeLog.LogRecords().AppendEmpty()
+	record.SetTimestamp(pcommon.NewTimestampFromTime(now))
+	record.SetObservedTimestamp(pcommon.NewTimestampFromTime(now))
+	record.SetSeverityNumber(plog.SeverityNumberWarn)
+	record.SetSeverityText(plog.SeverityNumberWarn.String())
+	record.SetEventName("partial.span.abandoned")
+	record.SetTraceID(span.TraceID())
+	record.SetSpanID(span.SpanID())
+	record.Body().SetStr("Partial span abandoned: " + span.Name())
+
+	attrs := record.Attributes()
+	attrs.PutStr("span.name", span.Name())
+	attrs.PutStr("partial.gc.reason", string(reason))
+	attrs.PutDouble("partial.span.age", now.Sub(span.StartTimestamp().AsTime()).Seconds())
+	attrs.PutStr("partial.last_heartbeat", pt.Timestamp.UTC().Format(time.RFC3339Nano))
+	if pt.PreviousGCReason != "" {
+		attrs.PutBool("partial.resurrected", true)
+	}
+
+	return logs
+}
@@ -0,0 +1,53 @@
+package otelpartialreceiver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+)
+
+func TestAbandonmentLogs(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	lastHeartbeat := now.Add(-time.Minute)
+
+	trace := ptrace.NewTraces()
+	rs := trace.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "checkout")
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("process-order")
+	span.SetTraceID(pcommon.TraceID{1, 2, 3})
+	span.SetSpanID(pcommon.SpanID{4, 5, 6})
+	span.SetStartTimestamp(pcommon.NewTimestampFromTime(now.Add(-time.Hour)))
+
+	logs := abandonmentLogs(trace, &postgres.PartialTrace{Timestamp: lastHeartbeat}, partial.GCReasonExpired, now)
+
+	assert.Equal(t, 1, logs.LogRecordCount())
+	resourceLog := logs.ResourceLogs().At(0)
+	serviceName, ok := resourceLog.Resource().Attributes().Get("service.name")
+	assert.True(t, ok)
+	assert.Equal(t, "checkout", serviceName.Str())
+
+	record := resourceLog.ScopeLogs().At(0).LogRecords().At(0)
+	assert.Equal(t, span.TraceID(), record.TraceID())
+	assert.Equal(t, span.SpanID(), record.SpanID())
+	assert.Equal(t, plog.SeverityNumberWarn, record.SeverityNumber())
+	assert.Equal(t, map[string]any{
+		"span.name":              "process-order",
+		"partial.gc.reason":      "expired",
+		"partial.span.age":       time.Hour.Seconds(),
+		"partial.last_heartbeat": lastHeartbeat.Format(time.RFC3339Nano),
+	}, record.Attributes().AsRaw())
+
+	logs = abandonmentLogs(trace, &postgres.PartialTrace{Timestamp: lastHeartbeat, PreviousGCReason: "expired"}, partial.GCReasonExpired, now)
+	resurrected, ok := logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().Get("partial.resurrected")
+	assert.True(t, ok)
+	assert.True(t, resurrected.Bool())
+}
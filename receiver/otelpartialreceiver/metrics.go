@@ -0,0 +1,89 @@
+package otelpartialreceiver
+
+import (
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+)
+
+// partialSpanMetrics creates the metrics describing the partial spans that are alive at the time now.
+// Metrics are grouped in resources by service.name, while the span name is set as the data point attribute.
+// The start timestamp of the histograms is the start of the receiver, so it stays the same between the reports.
+func partialSpanMetrics(start, now time.Time, cfg *MetricsConfig, ages, expiries []*postgres.SpanHistogram) pmetric.Metrics {
+	startTimestamp := pcommon.NewTimestampFromTime(start)
+	timestamp := pcommon.NewTimestampFromTime(now)
+	metrics := pmetric.NewMetrics()
+
+	type serviceMetrics struct {
+		live   pmetric.Gauge
+		age    pmetric.Histogram
+		expiry pmetric.Histogram
+	}
+	services := make(map[string]*serviceMetrics)
+	getService := func(name string) *serviceMetrics {
+		if sm, ok := services[name]; ok {
+			return sm
+		}
+
+		resourceMetrics := metrics.ResourceMetrics().AppendEmpty()
+		resourceMetrics.Resource().Attributes().PutStr("service.name", name)
+		scopeMetrics := resourceMetrics.ScopeMetrics().AppendEmpty()
+		scopeMetrics.Scope().SetName(typeStr.String())
+
+		live := scopeMetrics.Metrics().AppendEmpty()
+		live.SetName("partial.spans.live")
+		live.SetDescription("Number of partial spans stored in the database")
+		live.SetUnit("{span}")
+
+		age := scopeMetrics.Metrics().AppendEmpty()
+		age.SetName("partial.span.age")
+		age.SetDescription("Time elapsed since the start of the partial spans")
+		age.SetUnit("s")
+		age.SetEmptyHistogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+
+		expiry := scopeMetrics.Metrics().AppendEmpty()
+		expiry.SetName("partial.span.time_until_expiry")
+		expiry.SetDescription("Time left until the partial spans expire")
+		expiry.SetUnit("s")
+		expiry.SetEmptyHistogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+
+		sm := &serviceMetrics{
+			live:   live.SetEmptyGauge(),
+			age:    age.Histogram(),
+			expiry: expiry.Histogram(),
+		}
+		services[name] = sm
+		return sm
+	}
+
+	for _, h := range ages {
+		sm := getService(h.ServiceName)
+
+		dp := sm.live.DataPoints().AppendEmpty()
+		dp.SetTimestamp(timestamp)
+		dp.SetIntValue(int64(h.Count)) //nolint:gosec // count of rows cannot overflow int64
+		dp.Attributes().PutStr("span.name", h.SpanName)
+
+		appendHistogramDataPoint(sm.age, h, cfg.AgeBuckets, startTimestamp, timestamp)
+	}
+
+	for _, h := range expiries {
+		appendHistogramDataPoint(getService(h.ServiceName).expiry, h, cfg.ExpiryBuckets, startTimestamp, timestamp)
+	}
+
+	return metrics
+}
+
+func appendHistogramDataPoint(histogram pmetric.Histogram, h *postgres.SpanHistogram, bounds []float64, startTimestamp, timestamp pcommon.Timestamp) {
+	dp := histogram.DataPoints().AppendEmpty()
+	dp.SetStartTimestamp(startTimestamp)
+	dp.SetTimestamp(timestamp)
+	dp.SetCount(h.Count)
+	dp.SetSum(h.Sum)
+	dp.ExplicitBounds().FromRaw(bounds)
+	dp.BucketCounts().FromRaw(h.BucketCounts)
+	dp.Attributes().PutStr("span.name", h.SpanName)
+}
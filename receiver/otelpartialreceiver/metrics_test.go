@@ -0,0 +1,70 @@
+package otelpartialreceiver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+)
+
+func TestPartialSpanMetrics(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cfg := &MetricsConfig{
+		AgeBuckets:    []float64{60, 3600},
+		ExpiryBuckets: []float64{10},
+	}
+
+	ages := []*postgres.SpanHistogram{
+		{ServiceName: "checkout", SpanName: "process-order", Count: 3, Sum: 7300, BucketCounts: []uint64{1, 1, 1}},
+		{ServiceName: "checkout", SpanName: "refund", Count: 1, Sum: 30, BucketCounts: []uint64{1, 0, 0}},
+		{ServiceName: "billing", SpanName: "invoice", Count: 2, Sum: 600, BucketCounts: []uint64{0, 2, 0}},
+	}
+	expiries := []*postgres.SpanHistogram{
+		{ServiceName: "checkout", SpanName: "process-order", Count: 3, Sum: 20, BucketCounts: []uint64{2, 1}},
+	}
+
+	start := now.Add(-time.Hour)
+	metrics := partialSpanMetrics(start, now, cfg, ages, expiries)
+
+	require.Equal(t, 2, metrics.ResourceMetrics().Len())
+
+	checkout := metrics.ResourceMetrics().At(0)
+	serviceName, ok := checkout.Resource().Attributes().Get("service.name")
+	require.True(t, ok)
+	assert.Equal(t, "checkout", serviceName.Str())
+
+	ms := checkout.ScopeMetrics().At(0).Metrics()
+	require.Equal(t, 3, ms.Len())
+
+	live := ms.At(0)
+	assert.Equal(t, "partial.spans.live", live.Name())
+	require.Equal(t, pmetric.MetricTypeGauge, live.Type())
+	require.Equal(t, 2, live.Gauge().DataPoints().Len())
+	assert.Equal(t, int64(3), live.Gauge().DataPoints().At(0).IntValue())
+	assert.Equal(t, map[string]any{"span.name": "process-order"}, live.Gauge().DataPoints().At(0).Attributes().AsRaw())
+
+	age := ms.At(1)
+	assert.Equal(t, "partial.span.age", age.Name())
+	require.Equal(t, 2, age.Histogram().DataPoints().Len())
+	dp := age.Histogram().DataPoints().At(0)
+	assert.Equal(t, uint64(3), dp.Count())
+	assert.InDelta(t, 7300.0, dp.Sum(), 0)
+	assert.Equal(t, []float64{60, 3600}, dp.ExplicitBounds().AsRaw())
+	assert.Equal(t, []uint64{1, 1, 1}, dp.BucketCounts().AsRaw())
+	assert.Equal(t, start, dp.StartTimestamp().AsTime())
+	assert.Equal(t, now, dp.Timestamp().AsTime())
+
+	expiry := ms.At(2)
+	assert.Equal(t, "partial.span.time_until_expiry", expiry.Name())
+	require.Equal(t, 1, expiry.Histogram().DataPoints().Len())
+	assert.Equal(t, []float64{10}, expiry.Histogram().DataPoints().At(0).ExplicitBounds().AsRaw())
+
+	billing := metrics.ResourceMetrics().At(1)
+	assert.Equal(t, 1, billing.ScopeMetrics().At(0).Metrics().At(0).Gauge().DataPoints().Len())
+	assert.Equal(t, 0, billing.ScopeMetrics().At(0).Metrics().At(2).Histogram().DataPoints().Len())
+}
@@ -5,38 +5,139 @@ import (
 	"errors"
 	"fmt"
 	"math/rand/v2"
+	"sync"
 	"time"
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
-	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/plog"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.opentelemetry.io/collector/receiver"
 
+	"github.com/G-Research/otel-partial-collector/internal/partial"
 	"github.com/G-Research/otel-partial-collector/internal/postgres"
 	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 var typeStr = component.MustNewType("otelpartialreceiver")
 
+const meterName = "github.com/G-Research/otel-partial-collector/receiver/otelpartialreceiver"
+
 var tracesProtoUnmarshaler ptrace.ProtoUnmarshaler
 
+// pingInterval is the interval of the pings reporting the status of the database.
+const pingInterval = 10 * time.Second
+
 type otelPartialReceiver struct {
-	consumer   consumer.Traces
-	db         *postgres.DB
-	gcInterval time.Duration
-	host       component.Host
+	tracesConsumer  consumer.Traces
+	logsConsumer    consumer.Logs
+	metricsConsumer consumer.Metrics
+	db              *postgres.ShardedDB
+	gcInterval      time.Duration
+	metricsInterval time.Duration
+	completion      partial.CompletionConfig
+	tenant          TenantConfig
+	metrics         MetricsConfig
+	limiter         *emissionLimiter
+	snapshotLimiter *emissionLimiter
+	backlogGauge    metric.Int64Gauge
+	tracer          trace.Tracer
+	health          *partial.HealthReporter
+	host            component.Host
 
 	logger *zap.Logger
 
-	cancelFunc context.CancelFunc
-	doneCh     chan struct{}
+	drainTimeout          time.Duration
+	tombstoneRetention    time.Duration
+	resurrectionRetention time.Duration
+	clock                 partial.Clock
+	// gcCycles and snapshotCycles count the cycles, each only accessed by its loop
+	gcCycles       uint64
+	snapshotCycles uint64
+	// snapshotInterval is zero when the snapshots are disabled
+	snapshotInterval time.Duration
+	// startTime is the start timestamp of the reported histograms
+	startTime time.Time
+	// stopCh is closed on shutdown to stop the loops from starting new work,
+	// while cancelFunc aborts the in-flight work once the drain timeout is reached
+	stopCh       chan struct{}
+	cancelFunc   context.CancelFunc
+	wg           sync.WaitGroup
+	startOnce    sync.Once
+	shutdownOnce sync.Once
+	shutdownErr  error
+	cfg          *Config
+}
+
+// receivers keeps a single receiver per configuration, so the traces, logs and
+// metrics pipelines share the same database connection and gc loop.
+var (
+	receiversMu sync.Mutex
+	receivers   = map[*Config]*otelPartialReceiver{}
+)
+
+func newTracesReceiver(ctx context.Context, params receiver.Settings, baseCfg component.Config, consumer consumer.Traces) (receiver.Traces, error) {
+	r, err := getOrCreateReceiver(ctx, params, baseCfg.(*Config))
+	if err != nil {
+		return nil, err
+	}
+	r.tracesConsumer = consumer
+	return r, nil
+}
+
+func newLogsReceiver(ctx context.Context, params receiver.Settings, baseCfg component.Config, consumer consumer.Logs) (receiver.Logs, error) {
+	r, err := getOrCreateReceiver(ctx, params, baseCfg.(*Config))
+	if err != nil {
+		return nil, err
+	}
+	r.logsConsumer = consumer
+	return r, nil
+}
+
+func newMetricsReceiver(ctx context.Context, params receiver.Settings, baseCfg component.Config, consumer consumer.Metrics) (receiver.Metrics, error) {
+	r, err := getOrCreateReceiver(ctx, params, baseCfg.(*Config))
+	if err != nil {
+		return nil, err
+	}
+	r.metricsConsumer = consumer
+	return r, nil
 }
 
-func newPartialReceiver(ctx context.Context, params receiver.Settings, baseCfg component.Config, consumer consumer.Traces) (receiver.Traces, error) {
-	cfg := baseCfg.(*Config)
-	db, err := postgres.NewDB(ctx, cfg.Postgres)
+func getOrCreateReceiver(ctx context.Context, params receiver.Settings, cfg *Config) (*otelPartialReceiver, error) {
+	receiversMu.Lock()
+	defer receiversMu.Unlock()
+
+	if r, ok := receivers[cfg]; ok {
+		return r, nil
+	}
+
+	r, err := newPartialReceiver(ctx, params, cfg)
+	if err != nil {
+		return nil, err
+	}
+	receivers[cfg] = r
+	return r, nil
+}
+
+func newPartialReceiver(ctx context.Context, params receiver.Settings, cfg *Config) (*otelPartialReceiver, error) {
+	shards, err := postgres.ResolveShards(cfg.Postgres, cfg.Shards)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := postgres.NewShardedDB(
+		ctx,
+		shards,
+		postgres.WithTracerProvider(params.TracerProvider),
+		// the database is connected in the background after the start, see partial.HealthReporter
+		postgres.WithLazyConnect(),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new db connection: %w", err)
 	}
@@ -46,48 +147,190 @@ func newPartialReceiver(ctx context.Context, params receiver.Settings, baseCfg c
 		return nil, fmt.Errorf("failed to parse duration interval: %w", err)
 	}
 
+	metricsInterval, err := time.ParseDuration(cfg.Metrics.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics interval: %w", err)
+	}
+
+	snapshotInterval, err := time.ParseDuration(cfg.Snapshot.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot interval: %w", err)
+	}
+
+	drainTimeout, err := time.ParseDuration(cfg.ShutdownDrainTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse shutdown drain timeout: %w", err)
+	}
+
+	tombstoneRetention, err := time.ParseDuration(cfg.TombstoneRetention)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tombstone retention: %w", err)
+	}
+
+	resurrectionRetention, err := time.ParseDuration(cfg.ResurrectionRetention)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse resurrection retention: %w", err)
+	}
+
+	backlogGauge, err := params.MeterProvider.Meter(meterName).Int64Gauge(
+		"otelcol_otelpartialreceiver_gc_backlog",
+		metric.WithDescription("Number of expired spans left in the database after the gc cycle"),
+		metric.WithUnit("{span}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backlog gauge: %w", err)
+	}
+
 	r := &otelPartialReceiver{
-		db:         db,
-		logger:     params.Logger,
-		gcInterval: d,
-		consumer:   consumer,
+		db:                    db,
+		logger:                params.Logger,
+		gcInterval:            d,
+		metricsInterval:       metricsInterval,
+		snapshotInterval:      snapshotInterval,
+		completion:            cfg.Completion,
+		tenant:                cfg.Tenant,
+		metrics:               cfg.Metrics,
+		limiter:               newEmissionLimiter(cfg.RateLimit, d),
+		snapshotLimiter:       newEmissionLimiter(cfg.Snapshot.RateLimit, snapshotInterval),
+		drainTimeout:          drainTimeout,
+		tombstoneRetention:    tombstoneRetention,
+		resurrectionRetention: resurrectionRetention,
+		clock:                 cfg.Clock,
+		backlogGauge:          backlogGauge,
+		tracer:                params.TracerProvider.Tracer(meterName),
+		health:                partial.NewHealthReporter(db, pingInterval),
+		cfg:                   cfg,
 	}
 
 	return r, nil
 }
 
 func (r *otelPartialReceiver) Start(rootCtx context.Context, host component.Host) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	r.cancelFunc = cancel
-	r.doneCh = make(chan struct{})
-	r.host = host
+	// the status is reported to the host of every pipeline sharing the receiver
+	r.health.Start(host)
+	r.startOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		r.cancelFunc = cancel
+		r.stopCh = make(chan struct{})
+		r.startTime = time.Now()
+		r.host = host
+
+		// spans are only collected when there is a pipeline to send them to
+		if r.tracesConsumer != nil || r.logsConsumer != nil {
+			r.logger.Info("Starting gc loop", zap.String("gc_interval", r.gcInterval.String()))
+			r.wg.Add(1)
+			go r.loop(ctx)
+		}
 
-	r.logger.Info("Starting gc loop", zap.String("gc_interval", r.gcInterval.String()))
-	go r.loop(ctx)
+		if r.metricsConsumer != nil {
+			r.logger.Info("Starting metrics loop", zap.String("interval", r.metricsInterval.String()))
+			r.wg.Add(1)
+			go r.metricsLoop(ctx)
+		}
+
+		if r.tracesConsumer != nil && r.snapshotInterval > 0 {
+			r.logger.Info("Starting snapshot loop", zap.String("interval", r.snapshotInterval.String()))
+			r.wg.Add(1)
+			go r.snapshotLoop(ctx)
+		}
+	})
 
 	return rootCtx.Err()
 }
 
-func (r *otelPartialReceiver) Shutdown(context.Context) error {
-	r.logger.Info("Shutting down receiver")
-	if r.cancelFunc != nil {
-		r.cancelFunc()
-		r.logger.Info("Waiting on gc loop to finish")
-		<-r.doneCh
-		r.logger.Info("GC loop done")
+func (r *otelPartialReceiver) Shutdown(ctx context.Context) error {
+	r.shutdownOnce.Do(func() {
+		r.logger.Info("Shutting down receiver")
+		if r.cancelFunc != nil {
+			close(r.stopCh)
+			r.logger.Info("Waiting on loops to finish", zap.String("drain_timeout", r.drainTimeout.String()))
+			if !r.drain(ctx) {
+				r.logger.Warn("Drain timeout reached, aborting in-flight batch")
+			}
+			r.cancelFunc()
+			r.wg.Wait()
+			r.logger.Info("Loops done")
+			r.logUnprocessed(ctx)
+		}
+
+		receiversMu.Lock()
+		delete(receivers, r.cfg)
+		receiversMu.Unlock()
+
+		r.health.Shutdown()
+		r.shutdownErr = r.db.Close()
+	})
+	return r.shutdownErr
+}
+
+// drain waits for the loops to finish the in-flight work. It returns false
+// if the drain timeout or the shutdown context expires first.
+func (r *otelPartialReceiver) drain(ctx context.Context) bool {
+	doneCh := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(doneCh)
+	}()
+
+	timer := time.NewTimer(r.drainTimeout)
+	defer timer.Stop()
+	select {
+	case <-doneCh:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// logUnprocessed logs the expired traces left in the database after shutdown.
+func (r *otelPartialReceiver) logUnprocessed(ctx context.Context) {
+	if r.tracesConsumer == nil && r.logsConsumer == nil || !r.health.Connected() {
+		return
+	}
+
+	var count int64
+	for i, db := range r.db.Shards() {
+		now, err := r.now(ctx, db)
+		if err != nil {
+			r.logger.Warn("Failed to count expired traces left unprocessed", zap.String("shard", r.db.Name(i)), zap.Error(err))
+			return
+		}
+		shardCount, err := db.CountExpiredTraces(ctx, now)
+		if err != nil {
+			r.logger.Warn("Failed to count expired traces left unprocessed", zap.String("shard", r.db.Name(i)), zap.Error(err))
+			return
+		}
+		count += shardCount
+	}
+	if count > 0 {
+		r.logger.Info("Expired traces left unprocessed until the next start", zap.Int64("count", count))
+	}
+}
+
+func (r *otelPartialReceiver) stopping() bool {
+	select {
+	case <-r.stopCh:
+		return true
+	default:
+		return false
 	}
-	return r.db.Close()
 }
 
 func (r *otelPartialReceiver) loop(ctx context.Context) {
+	defer r.wg.Done()
 	for {
 		jitter := time.Millisecond * time.Duration(rand.IntN(1000)-500) // [-500ms,499ms]
 		select {
-		case <-ctx.Done():
+		case <-r.stopCh:
 			r.logger.Info("Stopping gc loop after shutdown")
-			close(r.doneCh)
 			return
 		case <-time.After(r.gcInterval + jitter):
+			if !r.health.Connected() {
+				r.logger.Debug("Database not connected yet, skipping the gc cycle")
+				continue
+			}
 			if err := r.gc(ctx); err != nil {
 				r.logger.Error("encountered errors while running gc", zap.Error(err))
 			}
@@ -95,10 +338,214 @@ func (r *otelPartialReceiver) loop(ctx context.Context) {
 	}
 }
 
-func (r *otelPartialReceiver) gc(ctx context.Context) error {
+func (r *otelPartialReceiver) metricsLoop(ctx context.Context) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.metricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stopCh:
+			r.logger.Info("Stopping metrics loop after shutdown")
+			return
+		case <-ticker.C:
+			if !r.health.Connected() {
+				r.logger.Debug("Database not connected yet, skipping the metrics report")
+				continue
+			}
+			if err := r.reportMetrics(ctx); err != nil {
+				r.logger.Error("encountered errors while reporting metrics", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (r *otelPartialReceiver) reportMetrics(ctx context.Context) error {
 	now := time.Now().UTC()
+	var ages, expiries []*postgres.SpanHistogram
+	for i, db := range r.db.Shards() {
+		shardNow, err := r.now(ctx, db)
+		if err != nil {
+			return fmt.Errorf("shard %q: %w", r.db.Name(i), err)
+		}
+		shardAges, shardExpiries, err := r.listHistograms(ctx, db, shardNow)
+		r.health.Observe(err)
+		if err != nil {
+			return fmt.Errorf("shard %q: %w", r.db.Name(i), err)
+		}
+		ages = append(ages, shardAges...)
+		expiries = append(expiries, shardExpiries...)
+	}
+
+	ages, expiries = postgres.MergeSpanHistograms(ages), postgres.MergeSpanHistograms(expiries)
+	return r.metricsConsumer.ConsumeMetrics(ctx, partialSpanMetrics(r.startTime, now, &r.metrics, ages, expiries))
+}
+
+// listHistograms lists the age and expiry histograms of the shard from the same snapshot.
+func (r *otelPartialReceiver) listHistograms(ctx context.Context, db *postgres.DB, now time.Time) ([]*postgres.SpanHistogram, []*postgres.SpanHistogram, error) {
+	var ages, expiries []*postgres.SpanHistogram
+	if err := db.Transact(
+		ctx,
+		pgx.TxOptions{
+			IsoLevel:       pgx.RepeatableRead,
+			AccessMode:     pgx.ReadOnly,
+			DeferrableMode: pgx.NotDeferrable,
+		},
+		func(ctx context.Context, db *postgres.DB) error {
+			var err error
+			ages, err = db.ListAgeHistograms(ctx, now, r.metrics.AgeBuckets)
+			if err != nil {
+				return fmt.Errorf("failed to get age histograms: %w", err)
+			}
+
+			expiries, err = db.ListExpiryHistograms(ctx, now, r.metrics.ExpiryBuckets)
+			if err != nil {
+				return fmt.Errorf("failed to get expiry histograms: %w", err)
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, nil, fmt.Errorf("transaction error: %w", err)
+	}
+
+	return ages, expiries, nil
+}
+
+// gc collects the expired traces of all the shards.
+func (r *otelPartialReceiver) gc(ctx context.Context) error {
+	ctx, span := r.tracer.Start(ctx, "gc")
+	defer span.End()
+
+	var errs []error
+	var backlog int64
+	shards := r.db.Shards()
+	order := shardOrder(len(shards), r.gcCycles)
+	r.gcCycles++
+	for _, i := range order {
+		db := shards[i]
+		shardCtx, shardSpan := r.tracer.Start(ctx, "gc shard", trace.WithAttributes(
+			attribute.String("db.shard", r.db.Name(i)),
+		))
+		shardBacklog, err := r.gcShard(shardCtx, db)
+		shardSpan.SetAttributes(attribute.Int64("backlog", shardBacklog))
+		if err != nil {
+			err = fmt.Errorf("shard %q: %w", r.db.Name(i), err)
+			errs = append(errs, err)
+			shardSpan.SetStatus(codes.Error, err.Error())
+		}
+		shardSpan.End()
+		backlog += shardBacklog
+	}
+
+	r.backlogGauge.Record(ctx, backlog)
+	span.SetAttributes(attribute.Int64("backlog", backlog))
+	err := errors.Join(errs...)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// gcShard collects the expired traces of the shard, unless its gc is paused.
+// It returns the number of expired traces left in the shard.
+func (r *otelPartialReceiver) gcShard(ctx context.Context, db *postgres.DB) (int64, error) {
+	now, err := r.now(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	paused, err := db.IsGCPaused(ctx)
+	r.health.Observe(err)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get gc state: %w", err)
+	}
+	if paused {
+		r.logger.Debug("GC is paused, skipping the cycle")
+		return db.CountExpiredTraces(ctx, now)
+	}
+
+	var errs []error
+	if err := r.emitBatches(ctx, r.limiter, func(ctx context.Context, limit int) (int, int, error) {
+		return r.gcBatch(ctx, db, now, limit)
+	}); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := db.RemoveExpiredTombstones(ctx, now); err != nil {
+		errs = append(errs, fmt.Errorf("failed to remove expired tombstones: %w", err))
+	}
+
+	backlog, err := db.CountExpiredTraces(ctx, now)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to count expired traces: %w", err))
+	}
+
+	return backlog, errors.Join(errs...)
+}
+
+// shardOrder returns the order the n shards are processed in during the cycle. The first shard
+// rotates every cycle, so the shards share the emission budget when they all have a backlog.
+func shardOrder(n int, cycle uint64) []int {
+	start := int(cycle % uint64(n))
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = (start + i) % n
+	}
+	return order
+}
+
+// emitBatches runs the batches of the gc or the snapshots until the traces are all listed,
+// the emission budget of the limiter is exhausted or the receiver shuts down. The batch collects up to limit traces,
+// where 0 means unlimited, and returns the number of listed and emitted traces.
+func (r *otelPartialReceiver) emitBatches(ctx context.Context, limiter *emissionLimiter, batch func(ctx context.Context, limit int) (int, int, error)) error {
+	for {
+		if r.stopping() {
+			r.logger.Info("Stopping emission after shutdown, leaving the remaining traces for the next start")
+			return nil
+		}
+
+		limit, ok := limiter.nextBatch(time.Now())
+		if !ok {
+			r.logger.Debug("Emission rate limit reached, leaving the remaining traces for later cycles")
+			return nil
+		}
+
+		listed, emitted, err := batch(ctx, limit)
+		limiter.emitted(time.Now(), limit, emitted)
+		if err != nil {
+			if ctx.Err() != nil {
+				r.logger.Warn(
+					"In-flight batch aborted on shutdown, emitted traces stay in the database and will be emitted again",
+					zap.Int("listed", listed),
+					zap.Int("emitted", emitted),
+				)
+			}
+			return err
+		}
+
+		// fewer traces than the limit means there is nothing left to emit
+		if limit == 0 || listed < limit {
+			return nil
+		}
+	}
+}
+
+// gcBatch collects up to limit expired traces in a single transaction. It returns
+// the number of listed traces and the number of emitted traces.
+func (r *otelPartialReceiver) gcBatch(ctx context.Context, db *postgres.DB, now time.Time, limit int) (listed int, emitted int, err error) {
+	ctx, span := r.tracer.Start(ctx, "gc batch", trace.WithAttributes(
+		attribute.Int("limit", limit),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("listed", listed), attribute.Int("emitted", emitted))
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	var errs []error
-	if err := r.db.Transact(
+	if err := db.Transact(
 		ctx,
 		pgx.TxOptions{
 			IsoLevel:       pgx.Serializable,
@@ -106,40 +553,138 @@ func (r *otelPartialReceiver) gc(ctx context.Context) error {
 			DeferrableMode: pgx.NotDeferrable,
 		},
 		func(ctx context.Context, db *postgres.DB) error {
-			traces, err := db.ListExpiredTraces(ctx, now)
+			errs, emitted = nil, 0
+			traces, err := r.listExpiredTraces(ctx, db, now, limit)
 			if err != nil {
 				return fmt.Errorf("failed to get expired traces: %w", err)
 			}
+			listed = len(traces)
 
 			for _, pt := range traces {
 				trace, err := tracesProtoUnmarshaler.UnmarshalTraces(pt.Trace)
 				if err != nil {
 					errs = append(errs, fmt.Errorf("failed to unmarshal traces: %w", err))
+					r.deadLetter(ctx, db, pt, err)
 					continue
 				}
 
+				reason := gcReason(pt)
+
 				span := trace.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
-				span.SetEndTimestamp(pcommon.NewTimestampFromTime(now))
-				attrs := span.Attributes()
-				attrs.PutBool("partial.gc", true)
+				r.completion.Complete(span, pt.Timestamp, pt.HeartbeatInterval, reason, now)
+				if pt.PreviousGCReason != "" {
+					partial.MarkResurrected(span, partial.GCReason(pt.PreviousGCReason), pt.PreviousGCAt)
+				}
+				emitCtx := r.tenant.attach(ctx, trace, pt.Tenant)
 
-				if err := r.consumer.ConsumeTraces(ctx, trace); err != nil {
-					errs = append(errs, fmt.Errorf("failed to consume trace %v: %w", trace, err))
-					continue
+				// the consumers own the trace once it is consumed, so the log record
+				// is built from it beforehand
+				var logs plog.Logs
+				if r.logsConsumer != nil {
+					logs = abandonmentLogs(trace, pt, reason, now)
+				}
+
+				if r.tracesConsumer != nil {
+					if err := r.tracesConsumer.ConsumeTraces(emitCtx, trace); err != nil {
+						errs = append(errs, fmt.Errorf("failed to consume trace %s/%s: %w", pt.TraceID, pt.SpanID, err))
+						if consumererror.IsPermanent(err) {
+							r.deadLetter(ctx, db, pt, err)
+						}
+						continue
+					}
+				}
+				emitted++
+
+				// the span is already emitted, so failing to emit the log record must not
+				// keep the trace in the database to be emitted again
+				if r.logsConsumer != nil {
+					if err := r.logsConsumer.ConsumeLogs(emitCtx, logs); err != nil {
+						errs = append(errs, fmt.Errorf("failed to consume abandonment log: %w", err))
+					}
 				}
 
-				if err := db.RemoveTrace(ctx, pt.TraceID, pt.SpanID); err != nil {
+				if err := db.RemoveTrace(ctx, pt.Tenant, pt.TraceID, pt.SpanID); err != nil {
 					errs = append(errs, fmt.Errorf("failed to rmeove trace: %w", err))
 					continue
 				}
+
+				// the span is still heartbeating, so the exporter must not store it again, while
+				// the other spans are recognized by the exporter if they heartbeat again
+				retention := r.resurrectionRetention
+				if reason == partial.GCReasonMaxLifetime {
+					retention = r.tombstoneRetention
+				}
+				if reason == partial.GCReasonMaxLifetime || retention > 0 {
+					if err := db.PutTombstone(ctx, pt.Tenant, pt.TraceID, pt.SpanID, string(reason), now.Add(retention)); err != nil {
+						errs = append(errs, fmt.Errorf("failed to put tombstone: %w", err))
+						continue
+					}
+				}
 			}
 			return nil
 		},
 	); err != nil {
-		return fmt.Errorf("transaction errors %w: %w", errors.Join(errs...), err)
+		// the errors of the transaction itself come from the database, unlike the
+		// errors of the consumers collected in errs
+		r.health.Observe(err)
+		return listed, emitted, fmt.Errorf("transaction errors %w: %w", errors.Join(errs...), err)
 	}
 
-	return errors.Join(errs...)
+	return listed, emitted, errors.Join(errs...)
+}
+
+// dbClock reads the clock of a shard.
+type dbClock interface {
+	Now(ctx context.Context) (time.Time, error)
+}
+
+// now returns the current time of the clock the expiration times are compared with.
+func (r *otelPartialReceiver) now(ctx context.Context, db dbClock) (time.Time, error) {
+	if r.clock != partial.ClockDatabase {
+		return time.Now().UTC(), nil
+	}
+	now, err := db.Now(ctx)
+	r.health.Observe(err)
+	return now, err
+}
+
+// listExpiredTraces lists up to limit expired traces in a span, separating the
+// time spent listing from the time spent emitting.
+func (r *otelPartialReceiver) listExpiredTraces(ctx context.Context, db *postgres.DB, now time.Time, limit int) ([]*postgres.PartialTrace, error) {
+	ctx, span := r.tracer.Start(ctx, "ListExpiredTraces")
+	defer span.End()
+
+	traces, err := db.ListExpiredTraces(ctx, now, limit)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("rows", len(traces)))
+	return traces, nil
+}
+
+// gcReason returns why the expired trace is collected.
+func gcReason(pt *postgres.PartialTrace) partial.GCReason {
+	switch {
+	case pt.Evicted:
+		return partial.GCReasonEvicted
+	case pt.Forced:
+		return partial.GCReasonForced
+	case !pt.LifetimeExpiresAt.IsZero() && !pt.ExpiresAt.Before(pt.LifetimeExpiresAt):
+		return partial.GCReasonMaxLifetime
+	default:
+		return partial.GCReasonExpired
+	}
+}
+
+// deadLetter excludes a trace that can never be emitted from the gc, so it
+// doesn't block the backlog. partialctl can requeue it once the cause is fixed.
+func (r *otelPartialReceiver) deadLetter(ctx context.Context, db *postgres.DB, pt *postgres.PartialTrace, cause error) {
+	if err := db.DeadLetterTrace(ctx, pt.Tenant, pt.TraceID, pt.SpanID, cause.Error()); err != nil {
+		r.logger.Error("failed to dead letter trace", zap.String("trace_id", pt.TraceID), zap.String("span_id", pt.SpanID), zap.Error(err))
+		return
+	}
+	r.logger.Warn("dead lettered trace", zap.String("trace_id", pt.TraceID), zap.String("span_id", pt.SpanID), zap.Error(cause))
 }
 
 func NewFactory() receiver.Factory {
@@ -147,7 +692,15 @@ func NewFactory() receiver.Factory {
 		typeStr,
 		createDefaultConfig,
 		receiver.WithTraces(
-			newPartialReceiver,
+			newTracesReceiver,
+			component.StabilityLevelAlpha,
+		),
+		receiver.WithLogs(
+			newLogsReceiver,
+			component.StabilityLevelAlpha,
+		),
+		receiver.WithMetrics(
+			newMetricsReceiver,
 			component.StabilityLevelAlpha,
 		),
 	)
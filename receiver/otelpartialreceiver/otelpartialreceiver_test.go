@@ -0,0 +1,50 @@
+package otelpartialreceiver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+)
+
+func TestGCReason(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		name string
+		pt   *postgres.PartialTrace
+		want partial.GCReason
+	}{
+		{
+			name: "expired",
+			pt:   &postgres.PartialTrace{ExpiresAt: now},
+			want: partial.GCReasonExpired,
+		},
+		{
+			name: "expired before max lifetime",
+			pt:   &postgres.PartialTrace{ExpiresAt: now, LifetimeExpiresAt: now.Add(time.Hour)},
+			want: partial.GCReasonExpired,
+		},
+		{
+			name: "max lifetime",
+			pt:   &postgres.PartialTrace{ExpiresAt: now, LifetimeExpiresAt: now},
+			want: partial.GCReasonMaxLifetime,
+		},
+		{
+			name: "forced",
+			pt:   &postgres.PartialTrace{ExpiresAt: now, LifetimeExpiresAt: now, Forced: true},
+			want: partial.GCReasonForced,
+		},
+		{
+			name: "evicted",
+			pt:   &postgres.PartialTrace{ExpiresAt: now, Forced: true, Evicted: true},
+			want: partial.GCReasonEvicted,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, gcReason(tt.pt))
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package otelpartialreceiver
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// emissionLimiter limits the rate at which collected or snapshot spans are emitted.
+// The budget accumulates over the interval of the gc or the snapshots, so every
+// cycle can emit up to the configured rate multiplied by the interval.
+type emissionLimiter struct {
+	// spans and batches are nil when unlimited
+	spans     *rate.Limiter
+	batches   *rate.Limiter
+	batchSize int
+
+	// mu guards reserved, the spans of the batches in progress, so the
+	// concurrent batches don't share the same budget
+	mu       sync.Mutex
+	reserved int
+}
+
+func newEmissionLimiter(cfg RateLimitConfig, interval time.Duration) *emissionLimiter {
+	l := &emissionLimiter{
+		batchSize: cfg.BatchSize,
+	}
+	if cfg.SpansPerSecond > 0 {
+		l.spans = rate.NewLimiter(rate.Limit(cfg.SpansPerSecond), burst(cfg.SpansPerSecond, interval))
+	}
+	if cfg.BatchesPerSecond > 0 {
+		l.batches = rate.NewLimiter(rate.Limit(cfg.BatchesPerSecond), burst(cfg.BatchesPerSecond, interval))
+	}
+	return l
+}
+
+func burst(perSecond float64, interval time.Duration) int {
+	return max(1, int(math.Ceil(perSecond*interval.Seconds())))
+}
+
+// nextBatch returns the maximum number of spans in the next batch, where 0 means unlimited,
+// and reserves them until the batch reports the emitted spans. It returns false when the
+// budget is exhausted and remaining spans should be left for later cycles.
+func (l *emissionLimiter) nextBatch(now time.Time) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	size := l.batchSize
+	if l.spans != nil {
+		tokens := int(l.spans.TokensAt(now)) - l.reserved
+		if tokens <= 0 {
+			return 0, false
+		}
+		if size == 0 || tokens < size {
+			size = tokens
+		}
+	}
+
+	if l.batches != nil && !l.batches.AllowN(now, 1) {
+		return 0, false
+	}
+
+	if l.spans != nil {
+		l.reserved += size
+	}
+	return size, true
+}
+
+// emitted releases the spans reserved by the batch of the given size and consumes
+// the span budget for the n emitted spans.
+func (l *emissionLimiter) emitted(now time.Time, size, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.spans != nil {
+		l.reserved -= size
+		if n > 0 {
+			l.spans.ReserveN(now, n)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package otelpartialreceiver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestEmissionLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("unlimited", func(t *testing.T) {
+		l := newEmissionLimiter(RateLimitConfig{}, 5*time.Second)
+		for range 10 {
+			size, ok := l.nextBatch(now)
+			assert.True(t, ok)
+			assert.Equal(t, 0, size)
+			l.emitted(now, size, 1000)
+		}
+	})
+
+	t.Run("spans per second", func(t *testing.T) {
+		l := newEmissionLimiter(RateLimitConfig{SpansPerSecond: 10, BatchSize: 30}, 5*time.Second)
+
+		size, ok := l.nextBatch(now)
+		assert.True(t, ok)
+		assert.Equal(t, 30, size)
+		l.emitted(now, size, size)
+
+		size, ok = l.nextBatch(now)
+		assert.True(t, ok)
+		assert.Equal(t, 20, size)
+		l.emitted(now, size, size)
+
+		_, ok = l.nextBatch(now)
+		assert.False(t, ok)
+
+		size, ok = l.nextBatch(now.Add(time.Second))
+		assert.True(t, ok)
+		assert.Equal(t, 10, size)
+	})
+
+	t.Run("concurrent batches", func(t *testing.T) {
+		l := newEmissionLimiter(RateLimitConfig{SpansPerSecond: 10, BatchSize: 30}, 5*time.Second)
+
+		// the second batch only gets the budget not reserved by the first one
+		first, ok := l.nextBatch(now)
+		assert.True(t, ok)
+		assert.Equal(t, 30, first)
+		second, ok := l.nextBatch(now)
+		assert.True(t, ok)
+		assert.Equal(t, 20, second)
+		_, ok = l.nextBatch(now)
+		assert.False(t, ok)
+
+		// the spans reserved but not emitted are released
+		l.emitted(now, first, 10)
+		l.emitted(now, second, 20)
+		size, ok := l.nextBatch(now)
+		assert.True(t, ok)
+		assert.Equal(t, 20, size)
+	})
+
+	t.Run("batches per second", func(t *testing.T) {
+		l := newEmissionLimiter(RateLimitConfig{BatchesPerSecond: 1, BatchSize: 10}, 2*time.Second)
+
+		for range 2 {
+			size, ok := l.nextBatch(now)
+			assert.True(t, ok)
+			assert.Equal(t, 10, size)
+		}
+
+		_, ok := l.nextBatch(now)
+		assert.False(t, ok)
+	})
+}
+
+func TestEmissionBudgetSharedByShards(t *testing.T) {
+	r := &otelPartialReceiver{logger: zap.NewNop()}
+	backlogs := []int{1000, 1000}
+
+	for cycle := range uint64(4) {
+		// every gc cycle starts with a full budget
+		r.limiter = newEmissionLimiter(RateLimitConfig{SpansPerSecond: 10, BatchSize: 20}, 5*time.Second)
+		for _, i := range shardOrder(len(backlogs), cycle) {
+			err := r.emitBatches(context.Background(), r.limiter, func(_ context.Context, limit int) (int, int, error) {
+				n := min(limit, backlogs[i])
+				backlogs[i] -= n
+				return n, n, nil
+			})
+			require.NoError(t, err)
+		}
+	}
+
+	// each shard emitted the whole budget of every other cycle
+	assert.Equal(t, []int{900, 900}, backlogs)
+}
+
+func TestSnapshotBudgetSeparateFromGC(t *testing.T) {
+	r := &otelPartialReceiver{
+		logger:          zap.NewNop(),
+		limiter:         newEmissionLimiter(RateLimitConfig{SpansPerSecond: 10}, 5*time.Second),
+		snapshotLimiter: newEmissionLimiter(RateLimitConfig{SpansPerSecond: 10}, time.Minute),
+	}
+	emit := func(limiter *emissionLimiter, backlog int) int {
+		var emitted int
+		err := r.emitBatches(context.Background(), limiter, func(_ context.Context, limit int) (int, int, error) {
+			n := min(limit, backlog-emitted)
+			emitted += n
+			return n, n, nil
+		})
+		require.NoError(t, err)
+		return emitted
+	}
+
+	// the snapshots exhaust their own budget and leave the budget of the gc untouched
+	assert.Equal(t, 600, emit(r.snapshotLimiter, 1000))
+	assert.Equal(t, 50, emit(r.limiter, 1000))
+}
@@ -0,0 +1,185 @@
+package otelpartialreceiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// snapshotBatchSize is the number of live traces listed at once for a snapshot.
+const snapshotBatchSize = 500
+
+// snapshotStore is the part of a shard used by the snapshots.
+type snapshotStore interface {
+	dbClock
+	ClaimSnapshotTraces(ctx context.Context, timestamp time.Time, interval time.Duration, limit int) ([]*postgres.PartialTrace, error)
+	ReleaseSnapshotTrace(ctx context.Context, tenant, traceID, spanID string, timestamp time.Time) error
+	RemoveExpiredSnapshotClaims(ctx context.Context, timestamp time.Time, interval time.Duration) (int64, error)
+}
+
+// SnapshotConfig defines the periodic snapshots of the live spans.
+type SnapshotConfig struct {
+	// Interval is the interval at which the stored state of the live spans is emitted,
+	// without removing them. Zero disables the snapshots.
+	Interval string `mapstructure:"interval"`
+	// RateLimit limits the rate at which the snapshot spans are emitted. The snapshots have
+	// their own budget, so they never delay the emission of the collected spans.
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+}
+
+func (c *SnapshotConfig) Validate() error {
+	interval, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return fmt.Errorf("failed to parse snapshot interval: %w", err)
+	}
+
+	if interval < 0 {
+		return errors.New("snapshot interval cannot be negative")
+	}
+
+	return nil
+}
+
+func (r *otelPartialReceiver) snapshotLoop(ctx context.Context) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stopCh:
+			r.logger.Info("Stopping snapshot loop after shutdown")
+			return
+		case <-ticker.C:
+			if !r.health.Connected() {
+				r.logger.Debug("Database not connected yet, skipping the snapshot")
+				continue
+			}
+			if err := r.snapshot(ctx); err != nil {
+				r.logger.Error("encountered errors while emitting snapshots", zap.Error(err))
+			}
+		}
+	}
+}
+
+// snapshot emits the live traces of all the shards.
+func (r *otelPartialReceiver) snapshot(ctx context.Context) error {
+	ctx, span := r.tracer.Start(ctx, "snapshot")
+	defer span.End()
+
+	var errs []error
+	var emitted int
+	shards := r.db.Shards()
+	order := shardOrder(len(shards), r.snapshotCycles)
+	r.snapshotCycles++
+	for _, i := range order {
+		db := shards[i]
+		shardCtx, shardSpan := r.tracer.Start(ctx, "snapshot shard", trace.WithAttributes(
+			attribute.String("db.shard", r.db.Name(i)),
+		))
+		shardEmitted, err := r.snapshotShard(shardCtx, db)
+		shardSpan.SetAttributes(attribute.Int("emitted", shardEmitted))
+		if err != nil {
+			err = fmt.Errorf("shard %q: %w", r.db.Name(i), err)
+			errs = append(errs, err)
+			shardSpan.SetStatus(codes.Error, err.Error())
+		}
+		shardSpan.End()
+		emitted += shardEmitted
+	}
+
+	span.SetAttributes(attribute.Int("emitted", emitted))
+	err := errors.Join(errs...)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// snapshotShard emits the live traces of the shard, ended provisionally at the time of the snapshot.
+// The traces are claimed in the database, so the receivers sharing the shard each emit different
+// traces, and the emitted spans count against the snapshot rate limit. The snapshots are not retried,
+// the next one emits the live traces again. It returns the number of emitted traces.
+func (r *otelPartialReceiver) snapshotShard(ctx context.Context, db snapshotStore) (int, error) {
+	now, err := r.now(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	var emitted int
+	if err := r.emitBatches(ctx, r.snapshotLimiter, func(ctx context.Context, limit int) (int, int, error) {
+		listed, batchEmitted, err := r.snapshotBatch(ctx, db, now, limit)
+		emitted += batchEmitted
+		return listed, batchEmitted, err
+	}); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := db.RemoveExpiredSnapshotClaims(ctx, now, r.snapshotInterval); err != nil {
+		errs = append(errs, fmt.Errorf("failed to remove expired snapshot claims: %w", err))
+	}
+
+	return emitted, errors.Join(errs...)
+}
+
+// snapshotBatch claims up to limit live traces and emits them, where 0 means all the live traces,
+// claimed snapshotBatchSize at a time. It returns the number of claimed traces and the number of
+// emitted traces.
+func (r *otelPartialReceiver) snapshotBatch(ctx context.Context, db snapshotStore, now time.Time, limit int) (listed int, emitted int, err error) {
+	size := limit
+	if size == 0 {
+		size = snapshotBatchSize
+	}
+
+	for {
+		traces, err := db.ClaimSnapshotTraces(ctx, now, r.snapshotInterval, size)
+		r.health.Observe(err)
+		if err != nil {
+			return listed, emitted, fmt.Errorf("failed to claim live traces: %w", err)
+		}
+		listed += len(traces)
+
+		for i, pt := range traces {
+			trace, err := tracesProtoUnmarshaler.UnmarshalTraces(pt.Trace)
+			if err != nil {
+				// a trace failing to unmarshal doesn't stop the snapshot
+				r.logger.Error("failed to unmarshal snapshot", zap.Error(err))
+				continue
+			}
+
+			span := trace.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+			partial.MarkSnapshot(span, now)
+			if err := r.tracesConsumer.ConsumeTraces(r.tenant.attach(ctx, trace, pt.Tenant), trace); err != nil {
+				// the rest of the snapshot is skipped rather than flooding the failing pipeline,
+				// and the claims of the traces not emitted are released for the next snapshot
+				err = fmt.Errorf("failed to consume snapshot: %w", err)
+				return listed, emitted, errors.Join(err, r.releaseSnapshotTraces(ctx, db, traces[i:], now))
+			}
+			emitted++
+		}
+
+		if limit > 0 || len(traces) < size || r.stopping() {
+			return listed, emitted, nil
+		}
+	}
+}
+
+// releaseSnapshotTraces releases the claims of the traces made at now, so the next snapshot emits them.
+func (r *otelPartialReceiver) releaseSnapshotTraces(ctx context.Context, db snapshotStore, traces []*postgres.PartialTrace, now time.Time) error {
+	for _, pt := range traces {
+		err := db.ReleaseSnapshotTrace(ctx, pt.Tenant, pt.TraceID, pt.SpanID, now)
+		r.health.Observe(err)
+		if err != nil {
+			return fmt.Errorf("failed to release the snapshot claims: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package otelpartialreceiver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/G-Research/otel-partial-collector/internal/partial"
+	"github.com/G-Research/otel-partial-collector/internal/postgres"
+	"go.uber.org/zap"
+)
+
+// fakeSnapshotStore keeps the traces and their snapshot claims in memory,
+// claiming the traces as the database does.
+type fakeSnapshotStore struct {
+	now      time.Time
+	traces   []*postgres.PartialTrace
+	claims   map[string]time.Time
+	released []string
+}
+
+func (s *fakeSnapshotStore) Now(context.Context) (time.Time, error) {
+	return s.now, nil
+}
+
+func (s *fakeSnapshotStore) ClaimSnapshotTraces(_ context.Context, timestamp time.Time, interval time.Duration, limit int) ([]*postgres.PartialTrace, error) {
+	var unclaimed, claimable []*postgres.PartialTrace
+	for _, pt := range s.traces {
+		claimedAt, ok := s.claims[pt.SpanID]
+		switch {
+		case pt.ExpiresAt.Before(timestamp):
+		case !ok:
+			unclaimed = append(unclaimed, pt)
+		case !claimedAt.After(timestamp.Add(-interval)):
+			claimable = append(claimable, pt)
+		}
+	}
+
+	claimed := append(unclaimed, claimable...)
+	if len(claimed) > limit {
+		claimed = claimed[:limit]
+	}
+	for _, pt := range claimed {
+		s.claims[pt.SpanID] = timestamp
+	}
+	return claimed, nil
+}
+
+func (s *fakeSnapshotStore) ReleaseSnapshotTrace(_ context.Context, _, _, spanID string, timestamp time.Time) error {
+	if s.claims[spanID].Equal(timestamp) {
+		delete(s.claims, spanID)
+		s.released = append(s.released, spanID)
+	}
+	return nil
+}
+
+func (s *fakeSnapshotStore) RemoveExpiredSnapshotClaims(_ context.Context, timestamp time.Time, interval time.Duration) (int64, error) {
+	var removed int64
+	for spanID, claimedAt := range s.claims {
+		if !claimedAt.After(timestamp.Add(-interval)) {
+			delete(s.claims, spanID)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func newFakeSnapshotStore(t *testing.T, now time.Time, expiresIn ...time.Duration) *fakeSnapshotStore {
+	s := &fakeSnapshotStore{now: now, claims: map[string]time.Time{}}
+	for i, d := range expiresIn {
+		trace := ptrace.NewTraces()
+		span := trace.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+		span.SetTraceID(pcommon.TraceID{1})
+		span.SetSpanID(pcommon.SpanID{byte(i + 1)})
+		span.SetStartTimestamp(pcommon.NewTimestampFromTime(now.Add(-time.Hour)))
+
+		b, err := (&ptrace.ProtoMarshaler{}).MarshalTraces(trace)
+		require.NoError(t, err)
+		s.traces = append(s.traces, &postgres.PartialTrace{
+			TraceID:   span.TraceID().String(),
+			SpanID:    span.SpanID().String(),
+			Trace:     b,
+			ExpiresAt: now.Add(d),
+		})
+	}
+	return s
+}
+
+func newSnapshotReceiver(consumer consumer.Traces, rateLimit RateLimitConfig) *otelPartialReceiver {
+	return &otelPartialReceiver{
+		tracesConsumer:   consumer,
+		logger:           zap.NewNop(),
+		clock:            partial.ClockDatabase,
+		health:           partial.NewHealthReporter(nil, time.Second),
+		snapshotInterval: time.Minute,
+		snapshotLimiter:  newEmissionLimiter(rateLimit, time.Minute),
+	}
+}
+
+func snapshotSpanIDs(traces []ptrace.Traces) []string {
+	var ids []string
+	for _, trace := range traces {
+		ids = append(ids, trace.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).SpanID().String())
+	}
+	return ids
+}
+
+func TestSnapshotShard(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newFakeSnapshotStore(t, now, time.Hour, -time.Second, 2*time.Hour)
+	sink := new(consumertest.TracesSink)
+	r := newSnapshotReceiver(sink, RateLimitConfig{})
+
+	// the expired trace is left for the gc
+	emitted, err := r.snapshotShard(context.Background(), store)
+	require.NoError(t, err)
+	assert.Equal(t, 2, emitted)
+	assert.Equal(t, []string{store.traces[0].SpanID, store.traces[2].SpanID}, snapshotSpanIDs(sink.AllTraces()))
+	for _, trace := range sink.AllTraces() {
+		span := trace.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+		assert.Equal(t, pcommon.NewTimestampFromTime(now), span.EndTimestamp())
+		assert.Equal(t, map[string]any{"partial.snapshot": true}, span.Attributes().AsRaw())
+	}
+
+	// the traces claimed during the interval are not emitted again
+	store.now = now.Add(30 * time.Second)
+	emitted, err = r.snapshotShard(context.Background(), store)
+	require.NoError(t, err)
+	assert.Equal(t, 0, emitted)
+
+	// the traces are kept, so the next snapshot emits them again
+	store.now = now.Add(time.Minute)
+	emitted, err = r.snapshotShard(context.Background(), store)
+	require.NoError(t, err)
+	assert.Equal(t, 2, emitted)
+	assert.Len(t, store.traces, 3)
+	assert.Equal(t, pcommon.NewTimestampFromTime(store.now), sink.AllTraces()[3].ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).EndTimestamp())
+}
+
+func TestSnapshotShardRateLimit(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newFakeSnapshotStore(t, now, time.Hour, time.Hour, time.Hour)
+	sink := new(consumertest.TracesSink)
+
+	// a budget of 2 spans per minute leaves the third trace unclaimed for the next snapshot
+	r := newSnapshotReceiver(sink, RateLimitConfig{SpansPerSecond: 1.0 / 30})
+	emitted, err := r.snapshotShard(context.Background(), store)
+	require.NoError(t, err)
+	assert.Equal(t, 2, emitted)
+	assert.NotContains(t, store.claims, store.traces[2].SpanID)
+
+	r = newSnapshotReceiver(sink, RateLimitConfig{SpansPerSecond: 1.0 / 30})
+	store.now = now.Add(time.Second)
+	emitted, err = r.snapshotShard(context.Background(), store)
+	require.NoError(t, err)
+	assert.Equal(t, 1, emitted)
+	assert.Equal(t, store.traces[2].SpanID, snapshotSpanIDs(sink.AllTraces())[2])
+}
+
+func TestSnapshotShardStopped(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newFakeSnapshotStore(t, now, time.Hour)
+	sink := new(consumertest.TracesSink)
+	r := newSnapshotReceiver(sink, RateLimitConfig{})
+	r.stopCh = make(chan struct{})
+	close(r.stopCh)
+
+	emitted, err := r.snapshotShard(context.Background(), store)
+	require.NoError(t, err)
+	assert.Equal(t, 0, emitted)
+	assert.Empty(t, store.claims)
+	assert.Equal(t, 0, sink.SpanCount())
+}
+
+func TestSnapshotShardConsumeError(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newFakeSnapshotStore(t, now, time.Hour, time.Hour, time.Hour)
+	errConsume := errors.New("pipeline failure")
+	var consumed int
+	failing, err := consumer.NewTraces(func(context.Context, ptrace.Traces) error {
+		consumed++
+		if consumed == 2 {
+			return errConsume
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// the claims of the failed trace and of the rest of the batch are released
+	r := newSnapshotReceiver(failing, RateLimitConfig{})
+	emitted, err := r.snapshotShard(context.Background(), store)
+	assert.ErrorIs(t, err, errConsume)
+	assert.Equal(t, 1, emitted)
+	assert.Equal(t, []string{store.traces[1].SpanID, store.traces[2].SpanID}, store.released)
+
+	// so the next snapshot emits them before the interval
+	sink := new(consumertest.TracesSink)
+	r.tracesConsumer = sink
+	store.now = now.Add(time.Second)
+	emitted, err = r.snapshotShard(context.Background(), store)
+	require.NoError(t, err)
+	assert.Equal(t, 2, emitted)
+	assert.Equal(t, []string{store.traces[1].SpanID, store.traces[2].SpanID}, snapshotSpanIDs(sink.AllTraces()))
+}
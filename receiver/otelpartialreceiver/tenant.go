@@ -0,0 +1,31 @@
+package otelpartialreceiver
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// attach attaches the tenant to the trace and to the context it is emitted with,
+// so multi-tenant backends receive abandoned spans in the tenant they belong to.
+func (c *TenantConfig) attach(ctx context.Context, trace ptrace.Traces, tenant string) context.Context {
+	if tenant == "" {
+		return ctx
+	}
+
+	if c.ResourceAttribute != "" {
+		attrs := trace.ResourceSpans().At(0).Resource().Attributes()
+		if _, ok := attrs.Get(c.ResourceAttribute); !ok {
+			attrs.PutStr(c.ResourceAttribute, tenant)
+		}
+	}
+
+	if c.MetadataKey == "" {
+		return ctx
+	}
+
+	info := client.FromContext(ctx)
+	info.Metadata = client.NewMetadata(map[string][]string{c.MetadataKey: {tenant}})
+	return client.NewContext(ctx, info)
+}
@@ -0,0 +1,48 @@
+package otelpartialreceiver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestAttachTenant(t *testing.T) {
+	newTrace := func() ptrace.Traces {
+		trace := ptrace.NewTraces()
+		trace.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+		return trace
+	}
+
+	cfg := TenantConfig{MetadataKey: "X-Scope-OrgID", ResourceAttribute: "tenant.id"}
+
+	t.Run("tenant", func(t *testing.T) {
+		trace := newTrace()
+		ctx := cfg.attach(context.Background(), trace, "team-a")
+
+		assert.Equal(t, []string{"team-a"}, client.FromContext(ctx).Metadata.Get("X-Scope-OrgID"))
+		v, ok := trace.ResourceSpans().At(0).Resource().Attributes().Get("tenant.id")
+		assert.True(t, ok)
+		assert.Equal(t, "team-a", v.Str())
+	})
+
+	t.Run("existing resource attribute", func(t *testing.T) {
+		trace := newTrace()
+		trace.ResourceSpans().At(0).Resource().Attributes().PutStr("tenant.id", "original")
+		cfg.attach(context.Background(), trace, "team-a")
+
+		v, _ := trace.ResourceSpans().At(0).Resource().Attributes().Get("tenant.id")
+		assert.Equal(t, "original", v.Str())
+	})
+
+	t.Run("no tenant", func(t *testing.T) {
+		trace := newTrace()
+		ctx := cfg.attach(context.Background(), trace, "")
+
+		assert.Empty(t, client.FromContext(ctx).Metadata.Get("X-Scope-OrgID"))
+		assert.Equal(t, 0, trace.ResourceSpans().At(0).Resource().Attributes().Len())
+	})
+}
@@ -0,0 +1,146 @@
+package partialspanprocessor
+
+import (
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/G-Research/otel-partial-collector/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// marshalSpan encodes the span as the body of a heartbeat or stop log.
+func marshalSpan(s sdktrace.ReadOnlySpan) (string, error) {
+	traces := ptrace.NewTraces()
+	resourceSpans := traces.ResourceSpans().AppendEmpty()
+	if res := s.Resource(); res != nil {
+		resourceSpans.SetSchemaUrl(res.SchemaURL())
+		putAttributes(resourceSpans.Resource().Attributes(), res.Attributes())
+	}
+
+	scope := s.InstrumentationScope()
+	scopeSpans := resourceSpans.ScopeSpans().AppendEmpty()
+	scopeSpans.SetSchemaUrl(scope.SchemaURL)
+	scopeSpans.Scope().SetName(scope.Name)
+	scopeSpans.Scope().SetVersion(scope.Version)
+	putAttributes(scopeSpans.Scope().Attributes(), scope.Attributes.ToSlice())
+
+	span := scopeSpans.Spans().AppendEmpty()
+	sc := s.SpanContext()
+	span.SetTraceID(pcommon.TraceID(sc.TraceID()))
+	span.SetSpanID(pcommon.SpanID(sc.SpanID()))
+	span.TraceState().FromRaw(sc.TraceState().String())
+	span.SetFlags(uint32(sc.TraceFlags()))
+	if parent := s.Parent(); parent.SpanID().IsValid() {
+		span.SetParentSpanID(pcommon.SpanID(parent.SpanID()))
+	}
+	span.SetName(s.Name())
+	span.SetKind(spanKind(s.SpanKind()))
+	span.SetStartTimestamp(timestamp(s.StartTime()))
+	span.SetEndTimestamp(timestamp(s.EndTime()))
+	putAttributes(span.Attributes(), s.Attributes())
+	span.SetDroppedAttributesCount(uint32(s.DroppedAttributes()))
+
+	for _, e := range s.Events() {
+		event := span.Events().AppendEmpty()
+		event.SetName(e.Name)
+		event.SetTimestamp(timestamp(e.Time))
+		putAttributes(event.Attributes(), e.Attributes)
+		event.SetDroppedAttributesCount(uint32(e.DroppedAttributeCount))
+	}
+	span.SetDroppedEventsCount(uint32(s.DroppedEvents()))
+
+	for _, l := range s.Links() {
+		link := span.Links().AppendEmpty()
+		link.SetTraceID(pcommon.TraceID(l.SpanContext.TraceID()))
+		link.SetSpanID(pcommon.SpanID(l.SpanContext.SpanID()))
+		link.TraceState().FromRaw(l.SpanContext.TraceState().String())
+		link.SetFlags(uint32(l.SpanContext.TraceFlags()))
+		putAttributes(link.Attributes(), l.Attributes)
+		link.SetDroppedAttributesCount(uint32(l.DroppedAttributeCount))
+	}
+	span.SetDroppedLinksCount(uint32(s.DroppedLinks()))
+
+	status := s.Status()
+	span.Status().SetCode(statusCode(status.Code))
+	span.Status().SetMessage(status.Description)
+
+	return protocol.MarshalBody(traces)
+}
+
+// timestamp converts the time, leaving the zero time of a span not ended yet unset.
+func timestamp(t time.Time) pcommon.Timestamp {
+	if t.IsZero() {
+		return 0
+	}
+	return pcommon.NewTimestampFromTime(t)
+}
+
+func spanKind(kind trace.SpanKind) ptrace.SpanKind {
+	switch kind {
+	case trace.SpanKindInternal:
+		return ptrace.SpanKindInternal
+	case trace.SpanKindServer:
+		return ptrace.SpanKindServer
+	case trace.SpanKindClient:
+		return ptrace.SpanKindClient
+	case trace.SpanKindProducer:
+		return ptrace.SpanKindProducer
+	case trace.SpanKindConsumer:
+		return ptrace.SpanKindConsumer
+	default:
+		return ptrace.SpanKindUnspecified
+	}
+}
+
+func statusCode(code codes.Code) ptrace.StatusCode {
+	switch code {
+	case codes.Ok:
+		return ptrace.StatusCodeOk
+	case codes.Error:
+		return ptrace.StatusCodeError
+	default:
+		return ptrace.StatusCodeUnset
+	}
+}
+
+func putAttributes(dst pcommon.Map, attrs []attribute.KeyValue) {
+	dst.EnsureCapacity(len(attrs))
+	for _, kv := range attrs {
+		key := string(kv.Key)
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			dst.PutBool(key, kv.Value.AsBool())
+		case attribute.INT64:
+			dst.PutInt(key, kv.Value.AsInt64())
+		case attribute.FLOAT64:
+			dst.PutDouble(key, kv.Value.AsFloat64())
+		case attribute.STRING:
+			dst.PutStr(key, kv.Value.AsString())
+		case attribute.BOOLSLICE:
+			s := dst.PutEmptySlice(key)
+			for _, v := range kv.Value.AsBoolSlice() {
+				s.AppendEmpty().SetBool(v)
+			}
+		case attribute.INT64SLICE:
+			s := dst.PutEmptySlice(key)
+			for _, v := range kv.Value.AsInt64Slice() {
+				s.AppendEmpty().SetInt(v)
+			}
+		case attribute.FLOAT64SLICE:
+			s := dst.PutEmptySlice(key)
+			for _, v := range kv.Value.AsFloat64Slice() {
+				s.AppendEmpty().SetDouble(v)
+			}
+		case attribute.STRINGSLICE:
+			s := dst.PutEmptySlice(key)
+			for _, v := range kv.Value.AsStringSlice() {
+				s.AppendEmpty().SetStr(v)
+			}
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Package partialspanprocessor provides an OpenTelemetry Go SDK span processor
+// emitting the heartbeat and stop logs of in-flight spans parsed by the
+// otelpartialexporter.
+package partialspanprocessor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/G-Research/otel-partial-collector/protocol"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const scopeName = "github.com/G-Research/otel-partial-collector/sdk/partialspanprocessor"
+
+// DefaultHeartbeatInterval is the interval between the heartbeats of a span
+// when WithHeartbeatInterval is not used.
+const DefaultHeartbeatInterval = 10 * time.Second
+
+type config struct {
+	heartbeatInterval time.Duration
+	version           protocol.Version
+}
+
+// Option configures the SpanProcessor.
+type Option func(*config)
+
+// WithHeartbeatInterval sets the interval between the heartbeats of a span.
+// Non-positive intervals are ignored.
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(c *config) {
+		if d > 0 {
+			c.heartbeatInterval = d
+		}
+	}
+}
+
+// WithProtocolVersion sets the version of the emitted logs, which must be
+// accepted by the collector. Unsupported versions are ignored.
+func WithProtocolVersion(v protocol.Version) Option {
+	return func(c *config) {
+		if v.Supported() {
+			c.version = v
+		}
+	}
+}
+
+type spanKey struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+// inFlightSpan is a tracked span. Its logs are emitted under its lock, so the stop
+// log is emitted after the heartbeat in progress when the span ends.
+type inFlightSpan struct {
+	span sdktrace.ReadWriteSpan
+
+	mu          sync.Mutex
+	heartbeated bool
+	ended       bool
+}
+
+// SpanProcessor tracks the sampled in-flight spans and emits a heartbeat log
+// for each of them every heartbeat interval, and a stop log when a span that
+// has been heartbeated ends. Spans ending before their first heartbeat emit no
+// log, as they are exported by the trace pipeline before the collector could
+// consider them abandoned.
+type SpanProcessor struct {
+	logger   log.Logger
+	interval time.Duration
+	version  protocol.Version
+
+	mu    sync.Mutex
+	spans map[spanKey]*inFlightSpan
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var _ sdktrace.SpanProcessor = (*SpanProcessor)(nil)
+
+// New returns a SpanProcessor emitting the logs with a logger of the provider
+// and starts its heartbeat loop.
+func New(provider log.LoggerProvider, opts ...Option) *SpanProcessor {
+	cfg := config{heartbeatInterval: DefaultHeartbeatInterval, version: protocol.Version1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	p := &SpanProcessor{
+		logger:   provider.Logger(scopeName),
+		interval: cfg.heartbeatInterval,
+		version:  cfg.version,
+		spans:    make(map[spanKey]*inFlightSpan),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+
+	return p
+}
+
+func (p *SpanProcessor) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.heartbeat(context.Background())
+		}
+	}
+}
+
+func (p *SpanProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	sc := s.SpanContext()
+	if !sc.IsSampled() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.spans[spanKey{traceID: sc.TraceID(), spanID: sc.SpanID()}] = &inFlightSpan{span: s}
+}
+
+func (p *SpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	sc := s.SpanContext()
+	key := spanKey{traceID: sc.TraceID(), spanID: sc.SpanID()}
+
+	p.mu.Lock()
+	inFlight, ok := p.spans[key]
+	delete(p.spans, key)
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	inFlight.mu.Lock()
+	defer inFlight.mu.Unlock()
+	inFlight.ended = true
+	if inFlight.heartbeated {
+		p.emit(context.Background(), protocol.EventTypeStop, s)
+	}
+}
+
+// ForceFlush emits a heartbeat for every in-flight span.
+func (p *SpanProcessor) ForceFlush(ctx context.Context) error {
+	p.heartbeat(ctx)
+	return ctx.Err()
+}
+
+// Shutdown stops the heartbeat loop. In-flight spans are no longer heartbeated,
+// so the collector emits them once they expire.
+func (p *SpanProcessor) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// heartbeat emits a heartbeat for every in-flight span. The spans ended since
+// they were listed are skipped, as their stop log has already been emitted.
+func (p *SpanProcessor) heartbeat(ctx context.Context) {
+	p.mu.Lock()
+	spans := make([]*inFlightSpan, 0, len(p.spans))
+	for _, inFlight := range p.spans {
+		spans = append(spans, inFlight)
+	}
+	p.mu.Unlock()
+
+	for _, inFlight := range spans {
+		inFlight.mu.Lock()
+		if !inFlight.ended {
+			inFlight.heartbeated = true
+			p.emit(ctx, protocol.EventTypeHeartbeat, inFlight.span)
+		}
+		inFlight.mu.Unlock()
+	}
+}
+
+func (p *SpanProcessor) emit(ctx context.Context, event protocol.EventType, s sdktrace.ReadOnlySpan) {
+	body, err := marshalSpan(s)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+
+	now := time.Now()
+	var record log.Record
+	record.SetTimestamp(now)
+	record.SetObservedTimestamp(now)
+	record.SetSeverity(log.SeverityInfo)
+	record.SetBody(log.StringValue(body))
+	if p.version != protocol.Version1 {
+		record.AddAttributes(log.Int(protocol.AttributeVersion, int(p.version)))
+	}
+	record.AddAttributes(
+		log.String(protocol.AttributeEvent, event.String()),
+		log.String(protocol.AttributeBodyType, string(protocol.BodyTypeProto)),
+	)
+	if event == protocol.EventTypeHeartbeat {
+		switch p.version {
+		case protocol.Version1:
+			record.AddAttributes(log.String(protocol.AttributeFrequency, p.interval.String()))
+		case protocol.Version2:
+			record.AddAttributes(log.Int64(protocol.AttributeFrequency, p.interval.Milliseconds()))
+		}
+	}
+
+	p.logger.Emit(trace.ContextWithSpanContext(ctx, s.SpanContext()), record)
+}
@@ -0,0 +1,394 @@
+package partialspanprocessor
+
+import (
+	"context"
+	"encoding/base64"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/G-Research/otel-partial-collector/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/embedded"
+	"go.opentelemetry.io/otel/log/logtest"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// syncRecorder serializes the emitted records with the reads of the
+// recorder, which does not guard its records against concurrent reads.
+type syncRecorder struct {
+	embedded.LoggerProvider
+	mu       sync.Mutex
+	recorder *logtest.Recorder
+}
+
+type syncLogger struct {
+	embedded.Logger
+	mu     *sync.Mutex
+	logger log.Logger
+}
+
+func (r *syncRecorder) Logger(name string, opts ...log.LoggerOption) log.Logger {
+	return &syncLogger{mu: &r.mu, logger: r.recorder.Logger(name, opts...)}
+}
+
+func (r *syncRecorder) records() []log.Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return records(r.recorder)
+}
+
+func (l *syncLogger) Emit(ctx context.Context, record log.Record) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logger.Emit(ctx, record)
+}
+
+func (l *syncLogger) Enabled(ctx context.Context, param log.EnabledParameters) bool {
+	return l.logger.Enabled(ctx, param)
+}
+
+// blockingRecorder records the events of the emitted logs, blocking the heartbeats
+// until they are released.
+type blockingRecorder struct {
+	embedded.LoggerProvider
+	heartbeating chan struct{}
+	release      chan struct{}
+
+	mu     sync.Mutex
+	events []string
+}
+
+type blockingLogger struct {
+	embedded.Logger
+	*blockingRecorder
+}
+
+func (r *blockingRecorder) Logger(string, ...log.LoggerOption) log.Logger {
+	return blockingLogger{blockingRecorder: r}
+}
+
+func (r *blockingRecorder) Emit(_ context.Context, record log.Record) {
+	event := attributes(record)[protocol.AttributeEvent]
+	if event == protocol.EventTypeHeartbeat.String() {
+		r.heartbeating <- struct{}{}
+		<-r.release
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *blockingRecorder) Enabled(context.Context, log.EnabledParameters) bool {
+	return true
+}
+
+func (r *blockingRecorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func records(recorder *logtest.Recorder) []log.Record {
+	var records []log.Record
+	for _, scope := range recorder.Result() {
+		for _, r := range scope.Records {
+			records = append(records, r.Record)
+		}
+	}
+	return records
+}
+
+func attributes(r log.Record) map[string]string {
+	attrs := make(map[string]string)
+	r.WalkAttributes(func(kv log.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.String()
+		return true
+	})
+	return attrs
+}
+
+func decodeSpan(t *testing.T, r log.Record) ptrace.ResourceSpans {
+	t.Helper()
+	b, err := base64.StdEncoding.DecodeString(r.Body().AsString())
+	require.NoError(t, err)
+
+	var u ptrace.ProtoUnmarshaler
+	traces, err := u.UnmarshalTraces(b)
+	require.NoError(t, err)
+	require.Equal(t, 1, traces.SpanCount())
+	return traces.ResourceSpans().At(0)
+}
+
+func TestSpanProcessor(t *testing.T) {
+	recorder := logtest.NewRecorder()
+	processor := New(recorder, WithHeartbeatInterval(time.Hour))
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "checkout"))),
+	)
+	defer func() {
+		assert.NoError(t, tp.Shutdown(context.Background()))
+	}()
+	tracer := tp.Tracer("test", trace.WithInstrumentationVersion("1.0.0"))
+
+	// spans ending before their first heartbeat emit nothing
+	_, short := tracer.Start(context.Background(), "short")
+	short.End()
+	assert.Empty(t, records(recorder))
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, span := tracer.Start(ctx, "long", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("http.route", "/orders"),
+		attribute.Int64Slice("ids", []int64{1, 2}),
+	))
+	span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", 2)))
+	span.SetStatus(codes.Error, "failed")
+
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	heartbeats := records(recorder)
+	require.Len(t, heartbeats, 2)
+
+	var heartbeat log.Record
+	for _, r := range heartbeats {
+		assert.Equal(t, map[string]string{
+			"partial.event":     "heartbeat",
+			"partial.body.type": "proto",
+			"partial.frequency": "1h0m0s",
+		}, attributes(r))
+		if decodeSpan(t, r).ScopeSpans().At(0).Spans().At(0).Name() == "long" {
+			heartbeat = r
+		}
+	}
+
+	resourceSpans := decodeSpan(t, heartbeat)
+	serviceName, ok := resourceSpans.Resource().Attributes().Get("service.name")
+	require.True(t, ok)
+	assert.Equal(t, "checkout", serviceName.Str())
+
+	scopeSpans := resourceSpans.ScopeSpans().At(0)
+	assert.Equal(t, "test", scopeSpans.Scope().Name())
+	assert.Equal(t, "1.0.0", scopeSpans.Scope().Version())
+
+	got := scopeSpans.Spans().At(0)
+	assert.Equal(t, span.SpanContext().TraceID().String(), got.TraceID().String())
+	assert.Equal(t, span.SpanContext().SpanID().String(), got.SpanID().String())
+	assert.Equal(t, parent.SpanContext().SpanID().String(), got.ParentSpanID().String())
+	assert.Equal(t, ptrace.SpanKindServer, got.Kind())
+	assert.NotZero(t, got.StartTimestamp())
+	assert.Zero(t, got.EndTimestamp())
+	assert.Equal(t, map[string]any{
+		"http.route": "/orders",
+		"ids":        []any{int64(1), int64(2)},
+	}, got.Attributes().AsRaw())
+	require.Equal(t, 1, got.Events().Len())
+	assert.Equal(t, "retry", got.Events().At(0).Name())
+	assert.Equal(t, ptrace.StatusCodeError, got.Status().Code())
+	assert.Equal(t, "failed", got.Status().Message())
+
+	recorder.Reset()
+	span.End()
+	stops := records(recorder)
+	require.Len(t, stops, 1)
+	assert.Equal(t, map[string]string{
+		"partial.event":     "stop",
+		"partial.body.type": "proto",
+	}, attributes(stops[0]))
+	assert.NotZero(t, decodeSpan(t, stops[0]).ScopeSpans().At(0).Spans().At(0).EndTimestamp())
+
+	// only the parent is still in flight
+	recorder.Reset()
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	require.Len(t, records(recorder), 1)
+	parent.End()
+}
+
+func TestSpanProcessorUnsampled(t *testing.T) {
+	recorder := logtest.NewRecorder()
+	processor := New(recorder)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithSampler(sdktrace.NeverSample()),
+	)
+	defer func() {
+		assert.NoError(t, tp.Shutdown(context.Background()))
+	}()
+
+	_, span := tp.Tracer("test").Start(context.Background(), "unsampled")
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	span.End()
+	assert.Empty(t, records(recorder))
+}
+
+func TestSpanProcessorHeartbeatInterval(t *testing.T) {
+	recorder := &syncRecorder{recorder: logtest.NewRecorder()}
+	processor := New(recorder, WithHeartbeatInterval(10*time.Millisecond))
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+
+	_, span := tp.Tracer("test").Start(context.Background(), "long")
+	assert.Eventually(t, func() bool {
+		return len(recorder.records()) >= 2
+	}, time.Second, 5*time.Millisecond)
+	span.End()
+
+	require.NoError(t, tp.Shutdown(context.Background()))
+	count := len(recorder.records())
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, count, len(recorder.records()))
+}
+
+func TestSpanProcessorProtocolVersion(t *testing.T) {
+	recorder := logtest.NewRecorder()
+	processor := New(recorder, WithHeartbeatInterval(1500*time.Millisecond), WithProtocolVersion(protocol.Version2))
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	defer func() {
+		assert.NoError(t, tp.Shutdown(context.Background()))
+	}()
+
+	_, span := tp.Tracer("test").Start(context.Background(), "long")
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	span.End()
+
+	got := records(recorder)
+	require.Len(t, got, 2)
+	assert.Equal(t, map[string]string{
+		"partial.version":   "2",
+		"partial.event":     "heartbeat",
+		"partial.body.type": "proto",
+		"partial.frequency": "1500",
+	}, attributes(got[0]))
+	assert.Equal(t, map[string]string{
+		"partial.version":   "2",
+		"partial.event":     "stop",
+		"partial.body.type": "proto",
+	}, attributes(got[1]))
+}
+
+func TestSpanProcessorStopAfterHeartbeat(t *testing.T) {
+	recorder := &blockingRecorder{heartbeating: make(chan struct{}), release: make(chan struct{})}
+	processor := New(recorder, WithHeartbeatInterval(time.Hour))
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	defer func() {
+		assert.NoError(t, tp.Shutdown(context.Background()))
+	}()
+
+	_, span := tp.Tracer("test").Start(context.Background(), "long")
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, processor.ForceFlush(context.Background()))
+	}()
+	<-recorder.heartbeating
+
+	// the span ending during its heartbeat waits for the heartbeat to be emitted
+	go func() {
+		defer wg.Done()
+		span.End()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, recorder.recorded())
+
+	close(recorder.release)
+	wg.Wait()
+	assert.Equal(t, []string{"heartbeat", "stop"}, recorder.recorded())
+
+	// the ended span is no longer heartbeated
+	require.NoError(t, processor.ForceFlush(context.Background()))
+	assert.Equal(t, []string{"heartbeat", "stop"}, recorder.recorded())
+}
+
+// recordedLogs converts the records of the recorder as the OTLP logs
+// received by the otelpartialexporter.
+func recordedLogs(recorder *logtest.Recorder) plog.Logs {
+	logs := plog.NewLogs()
+	for _, scope := range recorder.Result() {
+		scopeLogs := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty()
+		scopeLogs.Scope().SetName(scope.Name)
+		for _, r := range scope.Records {
+			logRecord := scopeLogs.LogRecords().AppendEmpty()
+			logRecord.Body().SetStr(r.Body().AsString())
+			r.WalkAttributes(func(kv log.KeyValue) bool {
+				switch kv.Value.Kind() {
+				case log.KindInt64:
+					logRecord.Attributes().PutInt(kv.Key, kv.Value.AsInt64())
+				default:
+					logRecord.Attributes().PutStr(kv.Key, kv.Value.String())
+				}
+				return true
+			})
+		}
+	}
+	recorder.Reset()
+	return logs
+}
+
+// decodeRecorded decodes the single record of the recorder as the otelpartialexporter does.
+func decodeRecorded(t *testing.T, recorder *logtest.Recorder) protocol.Message {
+	t.Helper()
+	logs := recordedLogs(recorder)
+	require.Equal(t, 1, logs.LogRecordCount())
+	msg, err := protocol.Decode(logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0))
+	require.NoError(t, err)
+	return msg
+}
+
+func TestSpanProcessorRoundTrip(t *testing.T) {
+	for _, version := range protocol.SupportedVersions {
+		t.Run("v"+version.String(), func(t *testing.T) {
+			testSpanProcessorRoundTrip(t, version)
+		})
+	}
+}
+
+func testSpanProcessorRoundTrip(t *testing.T, version protocol.Version) {
+	recorder := logtest.NewRecorder()
+	processor := New(
+		recorder,
+		WithHeartbeatInterval(time.Minute),
+		WithProtocolVersion(version),
+	)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "checkout"))),
+	)
+	defer func() {
+		assert.NoError(t, tp.Shutdown(context.Background()))
+	}()
+
+	_, span := tp.Tracer("test").Start(context.Background(), "process order")
+	span.SetAttributes(attribute.String("order.id", "42"))
+	require.NoError(t, processor.ForceFlush(context.Background()))
+
+	heartbeat := decodeRecorded(t, recorder)
+	assert.Equal(t, version, heartbeat.Version)
+	assert.Equal(t, protocol.EventTypeHeartbeat, heartbeat.Event)
+	assert.Equal(t, time.Minute, heartbeat.HeartbeatInterval)
+	require.Equal(t, 1, heartbeat.Traces.SpanCount())
+	resourceSpans := heartbeat.Traces.ResourceSpans().At(0)
+	serviceName, ok := resourceSpans.Resource().Attributes().Get("service.name")
+	require.True(t, ok)
+	assert.Equal(t, "checkout", serviceName.Str())
+	got := resourceSpans.ScopeSpans().At(0).Spans().At(0)
+	assert.Equal(t, "process order", got.Name())
+	assert.Equal(t, span.SpanContext().TraceID().String(), got.TraceID().String())
+	assert.Equal(t, span.SpanContext().SpanID().String(), got.SpanID().String())
+	assert.Equal(t, map[string]any{"order.id": "42"}, got.Attributes().AsRaw())
+
+	span.End()
+	stop := decodeRecorded(t, recorder)
+	assert.Equal(t, protocol.EventTypeStop, stop.Event)
+	require.Equal(t, 1, stop.Traces.SpanCount())
+	assert.Equal(t, span.SpanContext().SpanID().String(), stop.Traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).SpanID().String())
+}